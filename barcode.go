@@ -0,0 +1,133 @@
+package laminate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/ean"
+)
+
+// barcodeTypes are the barcode types, after normalizeBarcodeType, and
+// whether they are linear
+var barcodeTypes = map[string]bool{
+	"code128":    true,
+	"ean13":      true,
+	"ean8":       true,
+	"upca":       true,
+	"datamatrix": false,
+}
+
+// renderBarcode encodes the input as the barcode of the type var: code128
+// (default), ean13, ean8, upca or datamatrix. Surrounding whitespace,
+// such as the newline added by echo, is dropped.
+func renderBarcode(req *builtinRequest) ([]byte, error) {
+	typ := normalizeBarcodeType(req.get("type", "code128"))
+	linear, ok := barcodeTypes[typ]
+	if !ok {
+		return nil, fmt.Errorf("type must be one of code128, ean13, ean8, upca and datamatrix: %q", req.vars["type"])
+	}
+	content := strings.TrimSpace(req.input)
+	if content == "" {
+		return nil, fmt.Errorf("nothing to encode")
+	}
+
+	// Linear barcodes are a single row of modules as tall as the height var
+	style := &matrixStyle{}
+	var err error
+	if linear {
+		if style.moduleWidth, err = req.int("module_size", 2, 1, 64); err != nil {
+			return nil, err
+		}
+		if style.moduleHeight, err = req.int("height", 80, 1, 4096); err != nil {
+			return nil, err
+		}
+		if style.quietX, err = req.int("quiet_zone", 10, 0, 256); err != nil {
+			return nil, err
+		}
+	} else {
+		if style.moduleWidth, err = req.int("module_size", 8, 1, 64); err != nil {
+			return nil, err
+		}
+		style.moduleHeight = style.moduleWidth
+		if style.quietX, err = req.int("quiet_zone", 2, 0, 64); err != nil {
+			return nil, err
+		}
+		style.quietY = style.quietX
+	}
+	if err := style.setColors(req); err != nil {
+		return nil, err
+	}
+
+	var bc barcode.Barcode
+	switch typ {
+	case "code128":
+		bc, err = code128.Encode(content)
+	case "ean13", "ean8", "upca":
+		var code string
+		if code, err = checkEAN(typ, content); err == nil {
+			bc, err = ean.Encode(code)
+		}
+	case "datamatrix":
+		bc, err = datamatrix.Encode(content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", typ, err)
+	}
+	return newModuleMatrix(bc).render(req.format, style)
+}
+
+// normalizeBarcodeType lowercases the type and drops separators, so that
+// EAN-13 and UPC_A are accepted
+func normalizeBarcodeType(typ string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(typ))
+}
+
+// eanLengths are the lengths of the codes without and with the check digit
+var eanLengths = map[string][2]int{
+	"ean13": {12, 13},
+	"ean8":  {7, 8},
+	"upca":  {11, 12},
+}
+
+// checkEAN validates an EAN or UPC-A code, with or without its check digit,
+// and returns it as an EAN code. UPC-A codes are EAN-13 codes starting
+// with 0.
+func checkEAN(typ, code string) (string, error) {
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%s must consist of digits: %q", typ, code)
+		}
+	}
+	lengths := eanLengths[typ]
+	switch len(code) {
+	case lengths[0]:
+		code += string(eanCheckDigit(code))
+	case lengths[1]:
+		if want := eanCheckDigit(code[:len(code)-1]); code[len(code)-1] != want {
+			return "", fmt.Errorf("invalid %s check digit in %s: got %c, want %c", typ, code, code[len(code)-1], want)
+		}
+	default:
+		return "", fmt.Errorf("%s must have %d digits, or %d without the check digit: got %d", typ, lengths[1], lengths[0], len(code))
+	}
+	if typ == "upca" {
+		code = "0" + code
+	}
+	return code, nil
+}
+
+// eanCheckDigit returns the check digit of the digits: weights 3 and 1
+// alternate from the rightmost digit
+func eanCheckDigit(digits string) byte {
+	sum := 0
+	for i := range len(digits) {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
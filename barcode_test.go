@@ -0,0 +1,113 @@
+package laminate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEANCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"400638133393", '1'}, // EAN-13
+		{"9638507", '4'},      // EAN-8
+		{"03600029145", '2'},  // UPC-A
+		{"000000000000", '0'},
+	}
+	for _, tt := range tests {
+		if got := eanCheckDigit(tt.digits); got != tt.want {
+			t.Errorf("eanCheckDigit(%q) = %c, want %c", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestCheckEAN(t *testing.T) {
+	tests := []struct {
+		typ    string
+		code   string
+		want   string
+		errMsg string
+	}{
+		{typ: "ean13", code: "400638133393", want: "4006381333931"},
+		{typ: "ean13", code: "4006381333931", want: "4006381333931"},
+		{typ: "ean8", code: "96385074", want: "96385074"},
+		{typ: "upca", code: "03600029145", want: "0036000291452"},
+		{typ: "upca", code: "036000291452", want: "0036000291452"},
+		{typ: "ean13", code: "4006381333932", errMsg: "invalid ean13 check digit in 4006381333932: got 2, want 1"},
+		{typ: "ean13", code: "40063813339x", errMsg: "ean13 must consist of digits"},
+		{typ: "ean8", code: "123", errMsg: "ean8 must have 8 digits, or 7 without the check digit: got 3"},
+	}
+	for _, tt := range tests {
+		got, err := checkEAN(tt.typ, tt.code)
+		if tt.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("checkEAN(%q, %q) error = %v, want %q", tt.typ, tt.code, err, tt.errMsg)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("checkEAN(%q, %q) = %q, %v, want %q", tt.typ, tt.code, got, err, tt.want)
+		}
+	}
+}
+
+func TestRenderBarcode(t *testing.T) {
+	render := func(input, format string, vars map[string]string) []byte {
+		t.Helper()
+		data, err := renderBarcode(&builtinRequest{lang: "barcode", input: input, format: format, vars: vars})
+		if err != nil {
+			t.Fatalf("renderBarcode() error = %v", err)
+		}
+		return data
+	}
+
+	// EAN-13 has 95 modules, plus a quiet zone of 10 modules on each side
+	img := decodeTestPNG(t, render("4006381333931\n", "png", map[string]string{"type": "EAN-13"}))
+	if img.Bounds().Dx() != (95+20)*2 || img.Bounds().Dy() != 80 {
+		t.Errorf("Expected %dx80, got %v", (95+20)*2, img.Bounds())
+	}
+	if r, _, _, _ := img.At(20, 0).RGBA(); r != 0 {
+		t.Errorf("Expected the start guard to be black, got %v", img.At(20, 0))
+	}
+
+	img = decodeTestPNG(t, render("laminate", "png", map[string]string{"height": "30", "module_size": "1", "quiet_zone": "0"}))
+	if img.Bounds().Dy() != 30 {
+		t.Errorf("Expected height 30, got %d", img.Bounds().Dy())
+	}
+
+	// DataMatrix is square
+	img = decodeTestPNG(t, render("laminate", "png", map[string]string{"type": "datamatrix"}))
+	if img.Bounds().Dx() != img.Bounds().Dy() {
+		t.Errorf("Expected a square, got %v", img.Bounds())
+	}
+
+	svg := render("laminate", "svg", map[string]string{"type": "datamatrix"})
+	assertWellFormedSVG(t, svg)
+
+	if !bytes.Equal(render("12345", "png", nil), render("12345", "png", nil)) {
+		t.Error("Expected identical output for identical input")
+	}
+}
+
+func TestRenderBarcode_Errors(t *testing.T) {
+	tests := []struct {
+		input  string
+		vars   map[string]string
+		errMsg string
+	}{
+		{"123", map[string]string{"type": "pdf417"}, "type must be one of"},
+		{"4006381333932", map[string]string{"type": "ean13"}, "invalid ean13 check digit"},
+		{"日本", nil, "failed to encode code128"},
+		{"\n", nil, "nothing to encode"},
+		{"123", map[string]string{"height": "100000"}, "height must be an integer from 1 to 4096"},
+		{strings.Repeat("A", 80), map[string]string{"module_size": "64", "height": "4096"}, "exceeds the limit"},
+	}
+	for _, tt := range tests {
+		_, err := renderBarcode(&builtinRequest{input: tt.input, format: "png", vars: tt.vars})
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("renderBarcode(%q, %v) error = %v, want %q", tt.input, tt.vars, err, tt.errMsg)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package laminate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// batchRequest is a render job read by --batch as a single JSON line
+type batchRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Lang   string          `json:"lang"`
+	Input  string          `json:"input"`
+	Format string          `json:"format,omitempty"`
+}
+
+// batchResponse is written by --batch as a single JSON line for each request.
+// Data is base64 encoded.
+type batchResponse struct {
+	ID    json.RawMessage `json:"id,omitempty"`
+	Data  []byte          `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// runBatch renders the line-delimited JSON requests read from in one after
+// another, writing a response line for each to out. Worker processes are kept
+// alive across the requests. A failing request does not stop the batch.
+func runBatch(ctx context.Context, config *Config, in io.Reader, out io.Writer) error {
+	workers := config.getWorkers()
+	r := bufio.NewReader(in)
+	enc := json.NewEncoder(out)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if err := enc.Encode(renderBatchRequest(ctx, config, workers, line)); err != nil {
+				return fmt.Errorf("failed to write response: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read request: %w", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func renderBatchRequest(ctx context.Context, config *Config, workers *workerPool, line []byte) *batchResponse {
+	var req batchRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &batchResponse{Error: fmt.Sprintf("invalid request: %v", err)}
+	}
+	res := &batchResponse{ID: req.ID}
+	if req.Input == "" {
+		res.Error = "no input provided"
+		return res
+	}
+	c := *config
+	c.workers = workers
+	if req.Format != "" {
+		c.Format = req.Format
+	}
+	var buf bytes.Buffer
+	if err := ExecuteWithCache(ctx, &c, req.Lang, req.Input, &buf); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Data = buf.Bytes()
+	return res
+}
@@ -0,0 +1,146 @@
+package laminate
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// builtinRequest is a render job for a builtin renderer. Vars holds the
+// rule's vars overridden by the info string attributes.
+type builtinRequest struct {
+	lang   string
+	input  string
+	format string
+	vars   map[string]string
+}
+
+// builtinRenderer renders in-process, without an external command
+type builtinRenderer struct {
+	formats []string // the first one is the default
+	render  func(req *builtinRequest) ([]byte, error)
+	// detect returns the format of the input, which replaces the default for
+	// a renderer passing its input through
+	detect func(input string) string
+}
+
+// builtins are the renderers available to `builtin:` rules
+var builtins = map[string]*builtinRenderer{
+	"text":    {formats: []string{"png", "svg"}, render: renderText},
+	"qr":      {formats: []string{"png", "svg"}, render: renderQR},
+	"code":    {formats: []string{"png", "svg"}, render: renderCode},
+	"barcode": {formats: []string{"png", "svg"}, render: renderBarcode},
+	"chart":   {formats: []string{"png", "svg"}, render: renderChart},
+	"table":   {formats: []string{"png", "svg"}, render: renderTable},
+	"image":   {formats: []string{"png", "jpg", "gif", "svg"}, render: renderImage, detect: detectImageInput},
+}
+
+// renderFormat returns the format the builtin renders for the requested one.
+// Other raster formats are rendered as PNG and converted afterwards.
+func (b *builtinRenderer) renderFormat(format string) (string, bool) {
+	format = normalizeFormat(format)
+	if slices.Contains(b.formats, format) {
+		return format, true
+	}
+	if slices.Contains(rasterFormats, format) && slices.Contains(b.formats, "png") {
+		return "png", true
+	}
+	return "", false
+}
+
+// defaultFormat returns the format the builtin renders when none is asked
+// for: the format of the input when the builtin detects one it supports, or
+// its first format
+func (b *builtinRenderer) defaultFormat(input string) string {
+	if b.detect != nil {
+		if format := b.detect(input); slices.Contains(b.formats, format) {
+			return format
+		}
+	}
+	return b.formats[0]
+}
+
+// builtinPathVars are the vars naming files, which are taken from the rule's
+// vars only, so that the markdown cannot have arbitrary files read
+var builtinPathVars = []string{"font", "bold_font"}
+
+// getBuiltin returns the builtin renderer of the given name
+func getBuiltin(name string) (*builtinRenderer, error) {
+	b, ok := builtins[name]
+	if !ok {
+		return nil, &ConfigError{Err: fmt.Errorf("unknown builtin %q, available: %s",
+			name, strings.Join(slices.Sorted(maps.Keys(builtins)), ", "))}
+	}
+	return b, nil
+}
+
+// get returns the var, or def when it is unset or empty
+func (req *builtinRequest) get(name, def string) string {
+	if v := req.vars[name]; v != "" {
+		return v
+	}
+	return def
+}
+
+// int returns the var as an integer from minimum to maximum, or def when it
+// is unset or empty
+func (req *builtinRequest) int(name string, def, minimum, maximum int) (int, error) {
+	v := req.vars[name]
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < minimum || n > maximum {
+		return 0, fmt.Errorf("%s must be an integer from %d to %d: %q", name, minimum, maximum, v)
+	}
+	return n, nil
+}
+
+// float returns the var as a positive number up to maximum, or def when it is
+// unset or empty
+func (req *builtinRequest) float(name string, def, maximum float64) (float64, error) {
+	v := req.vars[name]
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 || f > maximum {
+		return 0, fmt.Errorf("%s must be a positive number up to %g: %q", name, maximum, v)
+	}
+	return f, nil
+}
+
+// maxImagePixels bounds the images builtins draw, whose size follows from
+// the input and from vars the markdown may set
+const maxImagePixels = 1 << 25
+
+// checkImageSize fails for an image too large to draw
+func checkImageSize(width, height int) error {
+	if width*height > maxImagePixels {
+		return fmt.Errorf("image of %dx%d pixels exceeds the limit of %d pixels", width, height, maxImagePixels)
+	}
+	return nil
+}
+
+// color returns the var as a color, or def when it is unset or empty
+func (req *builtinRequest) color(name, def string) (rgba, error) {
+	c, err := parseColor(req.get(name, def))
+	if err != nil {
+		return rgba{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return c, nil
+}
+
+// encodePNG encodes the image as PNG
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
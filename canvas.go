@@ -0,0 +1,165 @@
+package laminate
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// canvas is a drawing surface for builtins that lay out shapes, such as
+// charts. The same drawing calls produce PNG or SVG output.
+type canvas interface {
+	// polygon fills the closed polygon
+	polygon(pts []point, c rgba)
+	// polyline strokes the open line with round joins
+	polyline(pts []point, width float64, c rgba)
+	// text draws the text in the style's font with its baseline starting
+	// at (x, y)
+	text(style *textStyle, x, y float64, s string, c rgba)
+	// encode returns the drawing in its format
+	encode() ([]byte, error)
+}
+
+type point struct {
+	x, y float64
+}
+
+// newCanvas returns a canvas of the given format, png or svg, filled with the
+// background color
+func newCanvas(format string, width, height int, bg rgba) (canvas, error) {
+	if err := checkImageSize(width, height); err != nil {
+		return nil, err
+	}
+	switch format {
+	case "png":
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+		return &pngCanvas{img: img}, nil
+	case "svg":
+		c := &svgCanvas{}
+		fmt.Fprintf(&c.b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+			width, height, width, height)
+		if bg.A != 0 {
+			fmt.Fprintf(&c.b, `<rect width="%d" height="%d" %s/>`+"\n", width, height, svgFill(bg))
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unsupported format %s", format)
+}
+
+// fillRect fills the rectangle with its top left corner at (x, y)
+func fillRect(c canvas, x, y, w, h float64, col rgba) {
+	c.polygon([]point{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}, col)
+}
+
+// arc returns the points of the arc around the center, from angle a0 to a1
+// in radians, clockwise from 12 o'clock
+func arc(center point, r, a0, a1 float64) []point {
+	// Segments of at most 4 pixels, and at least 32 to a full circle
+	n := max(int(math.Ceil((a1-a0)*r/4)), int(math.Ceil((a1-a0)/(math.Pi/16))), 1)
+	pts := make([]point, 0, n+1)
+	for i := range n + 1 {
+		a := a0 + (a1-a0)*float64(i)/float64(n)
+		pts = append(pts, point{center.x + r*math.Sin(a), center.y - r*math.Cos(a)})
+	}
+	return pts
+}
+
+// pngCanvas draws antialiased shapes on an image
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+func (c *pngCanvas) polygon(pts []point, col rgba) {
+	if len(pts) < 3 {
+		return
+	}
+	b := c.img.Bounds()
+	r := vector.NewRasterizer(b.Dx(), b.Dy())
+	r.MoveTo(float32(pts[0].x), float32(pts[0].y))
+	for _, p := range pts[1:] {
+		r.LineTo(float32(p.x), float32(p.y))
+	}
+	r.ClosePath()
+	r.Draw(c.img, b, image.NewUniform(col), image.Point{})
+}
+
+// polyline draws every segment as a rectangle and every joint as a disc
+func (c *pngCanvas) polyline(pts []point, width float64, col rgba) {
+	for i := 1; i < len(pts); i++ {
+		p0, p1 := pts[i-1], pts[i]
+		dx, dy := p1.x-p0.x, p1.y-p0.y
+		l := math.Hypot(dx, dy)
+		if l == 0 {
+			continue
+		}
+		nx, ny := -dy/l*width/2, dx/l*width/2
+		c.polygon([]point{{p0.x + nx, p0.y + ny}, {p1.x + nx, p1.y + ny}, {p1.x - nx, p1.y - ny}, {p0.x - nx, p0.y - ny}}, col)
+		if i < len(pts)-1 {
+			c.polygon(arc(p1, width/2, 0, 2*math.Pi), col)
+		}
+	}
+}
+
+func (c *pngCanvas) text(style *textStyle, x, y float64, s string, col rgba) {
+	style.drawString(c.img, fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)}, s, col)
+}
+
+func (c *pngCanvas) encode() ([]byte, error) {
+	return encodePNG(c.img)
+}
+
+// svgCanvas writes shapes as SVG elements
+type svgCanvas struct {
+	b strings.Builder
+}
+
+func (c *svgCanvas) polygon(pts []point, col rgba) {
+	if len(pts) < 3 {
+		return
+	}
+	fmt.Fprintf(&c.b, `<polygon points="%s" %s/>`+"\n", svgPoints(pts), svgFill(col))
+}
+
+func (c *svgCanvas) polyline(pts []point, width float64, col rgba) {
+	fmt.Fprintf(&c.b, `<polyline points="%s" fill="none" %s stroke-width="%s" stroke-linejoin="round"/>`+"\n",
+		svgPoints(pts), svgPaint("stroke", col), formatFloat(width))
+}
+
+func (c *svgCanvas) text(style *textStyle, x, y float64, s string, col rgba) {
+	weight := ""
+	if style.bold {
+		weight = ` font-weight="bold"`
+	}
+	fmt.Fprintf(&c.b, `<text x="%s" y="%s" font-family="%s" font-size="%s"%s %s style="white-space:pre">%s</text>`+"\n",
+		formatFloat(x), formatFloat(y), svgEscape(style.fontFamily()), formatFloat(style.fontSize), weight,
+		svgFill(col), svgEscape(s))
+}
+
+func (c *svgCanvas) encode() ([]byte, error) {
+	return []byte(c.b.String() + "</svg>\n"), nil
+}
+
+// svgPoints formats the points for the points attribute
+func svgPoints(pts []point) string {
+	s := make([]string, len(pts))
+	for i, p := range pts {
+		s[i] = formatFloat(p.x) + "," + formatFloat(p.y)
+	}
+	return strings.Join(s, " ")
+}
+
+// formatFloat formats the number with at most two decimals
+func formatFloat(v float64) string {
+	v = math.Round(v*100) / 100
+	if v == 0 {
+		v = 0 // not -0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,345 @@
+package laminate
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// chartPalette is the default series colors, from Tableau 10
+const chartPalette = "#4e79a7,#f28e2b,#e15759,#76b7b2,#59a14f,#edc948,#b07aa1,#ff9da7,#9c755f,#bab0ac"
+
+// chartData is a table of numbers: a label for every row, and a series for
+// every numeric column
+type chartData struct {
+	labels []string
+	series []chartSeries
+}
+
+type chartSeries struct {
+	name   string
+	values []float64
+}
+
+// chart lays out a chart on a canvas
+type chart struct {
+	*chartData
+	style         *textStyle
+	canvas        canvas
+	colors        []rgba
+	width, height float64
+	title         string
+}
+
+// renderChart draws CSV or TSV input as a bar, line or pie chart
+func renderChart(req *builtinRequest) ([]byte, error) {
+	data, err := parseChartData(req.input)
+	if err != nil {
+		return nil, err
+	}
+	typ := strings.ToLower(req.get("type", "bar"))
+	if typ != "bar" && typ != "line" && typ != "pie" {
+		return nil, fmt.Errorf("type must be bar, line or pie: %q", typ)
+	}
+	width, err := req.int("width", 640, 64, 8192)
+	if err != nil {
+		return nil, err
+	}
+	height, err := req.int("height", 400, 64, 8192)
+	if err != nil {
+		return nil, err
+	}
+	var colors []rgba
+	for _, s := range strings.FieldsFunc(req.get("colors", chartPalette), func(r rune) bool { return r == ',' || r == ' ' }) {
+		c, err := parseColor(s)
+		if err != nil {
+			return nil, fmt.Errorf("colors: %w", err)
+		}
+		colors = append(colors, c)
+	}
+	if len(colors) == 0 {
+		return nil, fmt.Errorf("colors must not be empty")
+	}
+
+	style, err := newTextStyle(req)
+	if err != nil {
+		return nil, err
+	}
+	defer style.face.Close()
+	cv, err := newCanvas(req.format, width, height, style.bg)
+	if err != nil {
+		return nil, err
+	}
+	c := &chart{
+		chartData: data,
+		style:     style,
+		canvas:    cv,
+		colors:    colors,
+		width:     float64(width),
+		height:    float64(height),
+		title:     req.get("title", ""),
+	}
+	if typ == "pie" {
+		err = c.drawPie()
+	} else {
+		c.drawXY(typ == "line")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cv.encode()
+}
+
+// parseChartData parses CSV or TSV data. The first column holds the labels
+// and the others numbers, named by the header.
+func parseChartData(input string) (*chartData, error) {
+	records, err := readDelimited(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("data needs a header row and at least one row of values")
+	}
+	header := records[0]
+	if len(header) < 2 {
+		return nil, fmt.Errorf("data needs a label column and at least one column of values")
+	}
+	data := &chartData{}
+	for _, name := range header[1:] {
+		data.series = append(data.series, chartSeries{name: strings.TrimSpace(name)})
+	}
+	for i, record := range records[1:] {
+		data.labels = append(data.labels, strings.TrimSpace(record[0]))
+		for j, cell := range record[1:] {
+			v, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("row %d: %s is not a number: %q", i+2, data.series[j].name, cell)
+			}
+			data.series[j].values = append(data.series[j].values, v)
+		}
+	}
+	return data, nil
+}
+
+func (c *chart) color(i int) rgba {
+	return c.colors[i%len(c.colors)]
+}
+
+// textWidth returns the width of the text in pixels
+func (c *chart) textWidth(s string) float64 {
+	return float64(c.style.textWidth(s)) / 64
+}
+
+// drawHeader draws the title and, for several series, a legend, returning
+// the y below them
+func (c *chart) drawHeader(legend bool) float64 {
+	pad := float64(c.style.padding)
+	lh := float64(c.style.lineHeight())
+	ascent := float64(c.style.face.Metrics().Ascent) / 64
+	y := pad
+	if c.title != "" {
+		c.canvas.text(c.style, (c.width-c.textWidth(c.title))/2, y+ascent, c.title, c.style.fg)
+		y += lh + pad/2
+	}
+	if legend && len(c.series) > 1 {
+		var names []string
+		for _, s := range c.series {
+			names = append(names, s.name)
+		}
+		c.drawLegend((c.width-c.legendWidth(names))/2, y, names, false)
+		y += lh + pad/2
+	}
+	return y
+}
+
+// legendWidth returns the width of a horizontal legend
+func (c *chart) legendWidth(names []string) float64 {
+	lh := float64(c.style.lineHeight())
+	var w float64
+	for i, name := range names {
+		if i > 0 {
+			w += lh
+		}
+		w += lh*0.6 + lh/4 + c.textWidth(name)
+	}
+	return w
+}
+
+// drawLegend draws a swatch and a name for every entry, in a row or, when
+// vertical, in a column
+func (c *chart) drawLegend(x, y float64, names []string, vertical bool) {
+	lh := float64(c.style.lineHeight())
+	ascent := float64(c.style.face.Metrics().Ascent) / 64
+	swatch := lh * 0.6
+	x0 := x
+	for i, name := range names {
+		fillRect(c.canvas, x, y+(lh-swatch)/2, swatch, swatch, c.color(i))
+		c.canvas.text(c.style, x+swatch+lh/4, y+ascent, name, c.style.fg)
+		if vertical {
+			x, y = x0, y+lh
+		} else {
+			x += swatch + lh/4 + c.textWidth(name) + lh
+		}
+	}
+}
+
+// drawXY draws a bar chart, or a line chart, with a value axis on the left
+// and the labels along the bottom
+func (c *chart) drawXY(line bool) {
+	pad := float64(c.style.padding)
+	lh := float64(c.style.lineHeight())
+	metrics := c.style.face.Metrics()
+	ascent := float64(metrics.Ascent) / 64
+	capHeight := cmp.Or(float64(metrics.CapHeight)/64, ascent*0.7)
+
+	top := c.drawHeader(true) + capHeight/2
+	bottom := c.height - pad - lh - lh/4
+
+	lo, hi := 0.0, 0.0
+	for _, s := range c.series {
+		for _, v := range s.values {
+			lo, hi = min(lo, v), max(hi, v)
+		}
+	}
+	ticks, decimals := niceTicks(lo, hi, 5)
+	lo, hi = ticks[0], ticks[len(ticks)-1]
+	labels := make([]string, len(ticks))
+	var labelWidth float64
+	for i, t := range ticks {
+		labels[i] = strconv.FormatFloat(t, 'f', decimals, 64)
+		labelWidth = max(labelWidth, c.textWidth(labels[i]))
+	}
+	left := pad + labelWidth + lh/2
+	right := c.width - pad
+	y := func(v float64) float64 {
+		return bottom - (v-lo)/(hi-lo)*(bottom-top)
+	}
+
+	grid := c.style.fg
+	grid.A = 0x33
+	for i, t := range ticks {
+		ty := math.Round(y(t)) + 0.5 // on the pixel grid, for crisp lines
+		col := grid
+		if t == 0 {
+			col = c.style.fg
+		}
+		c.canvas.polyline([]point{{left, ty}, {right, ty}}, 1, col)
+		c.canvas.text(c.style, left-lh/2-c.textWidth(labels[i]), ty+capHeight/2, labels[i], c.style.fg)
+	}
+
+	slot := (right - left) / float64(len(c.labels))
+	for i, label := range c.labels {
+		cx := left + slot*(float64(i)+0.5)
+		c.canvas.text(c.style, cx-c.textWidth(label)/2, bottom+lh/4+ascent, label, c.style.fg)
+	}
+
+	if line {
+		for j, s := range c.series {
+			pts := make([]point, len(s.values))
+			for i, v := range s.values {
+				pts[i] = point{left + slot*(float64(i)+0.5), y(v)}
+			}
+			c.canvas.polyline(pts, 2, c.color(j))
+			for _, p := range pts {
+				c.canvas.polygon(arc(p, 3, 0, 2*math.Pi), c.color(j))
+			}
+		}
+		return
+	}
+	group := slot * 0.8
+	bar := group / float64(len(c.series))
+	for j, s := range c.series {
+		for i, v := range s.values {
+			x := left + slot*float64(i) + (slot-group)/2 + bar*float64(j)
+			y0, y1 := y(0), y(v)
+			fillRect(c.canvas, x, min(y0, y1), bar, math.Abs(y1-y0), c.color(j))
+		}
+	}
+}
+
+// drawPie draws the first series as a pie chart, with a legend of the labels
+// and their shares on the right
+func (c *chart) drawPie() error {
+	values := c.series[0].values
+	var total float64
+	for _, v := range values {
+		if v < 0 {
+			return fmt.Errorf("pie charts need values of at least 0: %v", v)
+		}
+		total += v
+	}
+	if total == 0 {
+		return fmt.Errorf("pie charts need a total above 0")
+	}
+
+	pad := float64(c.style.padding)
+	lh := float64(c.style.lineHeight())
+	top := c.drawHeader(false)
+	names := make([]string, len(c.labels))
+	var legendWidth float64
+	for i, label := range c.labels {
+		names[i] = fmt.Sprintf("%s (%s%%)", label, strconv.FormatFloat(values[i]/total*100, 'f', 1, 64))
+		legendWidth = max(legendWidth, lh*0.6+lh/4+c.textWidth(names[i]))
+	}
+
+	bottom := c.height - pad
+	legendX := c.width - pad - legendWidth
+	r := max(min((legendX-pad*2)/2, (bottom-top)/2), 1)
+	center := point{legendX / 2, top + (bottom-top)/2}
+	c.drawLegend(legendX, center.y-lh*float64(len(names))/2, names, true)
+
+	var a float64
+	for i, v := range values {
+		if v == 0 {
+			continue
+		}
+		a1 := a + v/total*2*math.Pi
+		c.canvas.polygon(append([]point{center}, arc(center, r, a, a1)...), c.color(i))
+		a = a1
+	}
+	return nil
+}
+
+// niceTicks returns evenly spaced ticks at round numbers, about n intervals
+// covering lo to hi, and the number of decimals to format them with
+func niceTicks(lo, hi float64, n int) ([]float64, int) {
+	if hi == lo {
+		hi = lo + 1
+	}
+	raw := (hi - lo) / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := mag
+	for _, m := range []float64{2, 5, 10} {
+		if step >= raw {
+			break
+		}
+		step = m * mag
+	}
+	var ticks []float64
+	for k := math.Floor(lo / step); ; k++ {
+		ticks = append(ticks, k*step)
+		if k*step >= hi {
+			break
+		}
+	}
+	return ticks, max(0, -int(math.Floor(math.Log10(step))))
+}
+
+// readDelimited reads CSV, or TSV when the first row contains a tab. Every
+// row must have as many fields as the first.
+func readDelimited(input string) ([][]string, error) {
+	input = strings.TrimSpace(input)
+	r := csv.NewReader(strings.NewReader(input))
+	if header, _, _ := strings.Cut(input, "\n"); strings.Contains(header, "\t") {
+		r.Comma = '\t'
+	}
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse data: %w", err)
+	}
+	return records, nil
+}
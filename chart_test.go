@@ -0,0 +1,130 @@
+package laminate
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseChartData(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   *chartData
+		errMsg string
+	}{
+		{
+			name:  "csv",
+			input: "month, sales, costs\nJan, 1.5, 2\nFeb, -3, 4e2\n",
+			want: &chartData{
+				labels: []string{"Jan", "Feb"},
+				series: []chartSeries{{"sales", []float64{1.5, -3}}, {"costs", []float64{2, 400}}},
+			},
+		},
+		{
+			name:  "tsv",
+			input: "fruit\tcount\n\"Apple, red\"\t3\nBanana\t5",
+			want: &chartData{
+				labels: []string{"Apple, red", "Banana"},
+				series: []chartSeries{{"count", []float64{3, 5}}},
+			},
+		},
+		{name: "no_values", input: "a,b\n", errMsg: "data needs a header row and at least one row of values"},
+		{name: "no_value_column", input: "a\nb\n", errMsg: "data needs a label column"},
+		{name: "not_a_number", input: "a,b\nx,1\ny,many\n", errMsg: `row 3: b is not a number: "many"`},
+		{name: "ragged", input: "a,b\nx,1,2\n", errMsg: "wrong number of fields"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseChartData(tt.input)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNiceTicks(t *testing.T) {
+	tests := []struct {
+		lo, hi float64
+		want   string
+	}{
+		{0, 200, "0 50 100 150 200"},
+		{-30, 200, "-50 0 50 100 150 200"},
+		{0, 0.7, "0.0 0.2 0.4 0.6 0.8"},
+		{0, 0, "0.0 0.2 0.4 0.6 0.8 1.0"},
+		{1200, 4800, "1000 2000 3000 4000 5000"},
+	}
+	for _, tt := range tests {
+		ticks, decimals := niceTicks(tt.lo, tt.hi, 5)
+		var got []string
+		for _, v := range ticks {
+			got = append(got, strconv.FormatFloat(v, 'f', decimals, 64))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("niceTicks(%v, %v) = %v, want %s", tt.lo, tt.hi, got, tt.want)
+		}
+	}
+}
+
+func TestRenderChart(t *testing.T) {
+	input := "month,sales,costs\nJan,120,80\nFeb,150,90\nMar,-30,100\n"
+	for _, typ := range []string{"bar", "line", "pie"} {
+		t.Run(typ, func(t *testing.T) {
+			vars := map[string]string{"type": typ, "title": "Sales <2024>", "width": "320", "height": "200"}
+			if typ == "pie" {
+				input = "fruit,count\nApple,3\nBanana,5\nCherry,0\n"
+			}
+			data, err := renderChart(&builtinRequest{input: input, format: "png", vars: vars})
+			if err != nil {
+				t.Fatal(err)
+			}
+			img := decodeTestPNG(t, data)
+			if img.Bounds().Dx() != 320 || img.Bounds().Dy() != 200 {
+				t.Errorf("Expected 320x200, got %v", img.Bounds())
+			}
+
+			data, err = renderChart(&builtinRequest{input: input, format: "svg", vars: vars})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertWellFormedSVG(t, data)
+			for _, want := range []string{`width="320" height="200"`, "Sales &lt;2024&gt;", `fill="#4e79a7"`} {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("Expected SVG to contain %q, got:\n%s", want, data)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderChart_Errors(t *testing.T) {
+	tests := []struct {
+		input  string
+		vars   map[string]string
+		errMsg string
+	}{
+		{"a,b\nx,1\n", map[string]string{"type": "scatter"}, "type must be bar, line or pie"},
+		{"a,b\nx,1\n", map[string]string{"colors": "red,nope"}, `colors: invalid color "nope"`},
+		{"a,b\nx,1\n", map[string]string{"width": "10"}, "width must be an integer from 64 to 8192"},
+		{"a,b\nx,1\n", map[string]string{"height": "100000"}, "height must be an integer from 64 to 8192"},
+		{"a,b\nx,1\ny,-1\n", map[string]string{"type": "pie"}, "pie charts need values of at least 0"},
+		{"a,b\nx,0\n", map[string]string{"type": "pie"}, "pie charts need a total above 0"},
+	}
+	for _, tt := range tests {
+		_, err := renderChart(&builtinRequest{input: tt.input, format: "png", vars: tt.vars})
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("renderChart(%q, %v) error = %v, want %q", tt.input, tt.vars, err, tt.errMsg)
+		}
+	}
+}
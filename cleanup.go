@@ -0,0 +1,27 @@
+package laminate
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tempDirPrefix is the prefix of the temporary directories laminate creates
+const tempDirPrefix = "laminate-"
+
+// staleTempDirAge is the age after which a temporary directory is considered
+// to be left behind by a laminate process that was killed
+const staleTempDirAge = 24 * time.Hour
+
+// sweepStaleTempDirs removes temporary directories left by earlier runs that
+// could not clean up after themselves
+func sweepStaleTempDirs() {
+	matches, _ := filepath.Glob(filepath.Join(os.TempDir(), tempDirPrefix+"*"))
+	for _, dir := range matches {
+		info, err := os.Lstat(dir)
+		if err != nil || !info.IsDir() || time.Since(info.ModTime()) < staleTempDirAge {
+			continue
+		}
+		os.RemoveAll(dir) // Ignore errors
+	}
+}
@@ -0,0 +1,42 @@
+package laminate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweepStaleTempDirs(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	old := time.Now().Add(-2 * staleTempDirAge)
+	mkdir := func(name string, mtime time.Time) string {
+		dir := filepath.Join(tmp, name)
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "output.png"), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	stale := mkdir("laminate-123", old)
+	active := mkdir("laminate-456", time.Now())
+	other := mkdir("other-789", old)
+
+	sweepStaleTempDirs()
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected stale directory to be removed, got %v", err)
+	}
+	for _, dir := range []string{active, other} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", dir, err)
+		}
+	}
+}
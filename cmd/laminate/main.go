@@ -2,21 +2,33 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/Songmu/laminate"
 )
 
 func main() {
 	log.SetFlags(0)
-	err := laminate.Run(context.Background(), os.Args[1:], os.Stdout, os.Stderr)
+	// Turn SIGINT and SIGTERM into cancellation, so that the command is
+	// terminated gracefully and temporary files are removed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := laminate.Run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
 	if err != nil && err != flag.ErrHelp {
-		log.Println(err)
+		if !laminate.IsReported(err) {
+			log.Println(err)
+		}
 		exitCode := 1
-		if ecoder, ok := err.(interface{ ExitCode() int }); ok {
+		var ecoder interface{ ExitCode() int }
+		if errors.As(err, &ecoder) {
 			exitCode = ecoder.ExitCode()
+		} else if errors.Is(err, context.Canceled) {
+			exitCode = 130
 		}
 		os.Exit(exitCode)
 	}
@@ -0,0 +1,144 @@
+package laminate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// renderCode draws the input with syntax highlighting by chroma. The lexer
+// is selected by the language var, or the lang, or else by analysing the
+// input.
+func renderCode(req *builtinRequest) ([]byte, error) {
+	style, lines, err := highlightCode(req)
+	if err != nil {
+		return nil, err
+	}
+	defer style.face.Close()
+	return style.render(lines, req.format)
+}
+
+// highlightCode lays out the input as lines of colored spans, with the
+// colors of the theme var (a chroma style) unless foreground and background
+// are given
+func highlightCode(req *builtinRequest) (*textStyle, []textLine, error) {
+	theme := styles.Get(req.get("theme", "github"))
+	if name := req.vars["theme"]; name != "" && styles.Registry[strings.ToLower(name)] == nil {
+		return nil, nil, fmt.Errorf("unknown theme %q", name)
+	}
+	// The theme supplies the default colors
+	bg := theme.Get(chroma.Background)
+	vars := map[string]string{
+		"foreground": chromaColor(bg.Colour, "#000000"),
+		"background": chromaColor(bg.Background, "#ffffff"),
+	}
+	for k, v := range req.vars {
+		vars[k] = v
+	}
+	req = &builtinRequest{lang: req.lang, input: req.input, format: req.format, vars: vars}
+
+	style, err := newTextStyle(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	fail := func(err error) (*textStyle, []textLine, error) {
+		style.face.Close()
+		return nil, nil, err
+	}
+	style.highlight, _ = parseColor(chromaColor(theme.Get(chroma.LineHighlight).Background, "#ffffcc"))
+	highlighted, err := parseLineRanges(req.get("highlight", ""))
+	if err != nil {
+		return fail(err)
+	}
+	lineStart, err := req.int("line_start", 1, 0, 1<<30)
+	if err != nil {
+		return fail(err)
+	}
+	lineNumbers := req.get("line_numbers", "false") == "true"
+
+	lexer := lexers.Get(req.get("language", req.lang))
+	if lexer == nil {
+		lexer = lexers.Analyse(req.input)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	input := strings.TrimRight(strings.ReplaceAll(req.input, "\r\n", "\n"), "\n")
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, input)
+	if err != nil {
+		return fail(fmt.Errorf("failed to tokenise: %w", err))
+	}
+	tokenLines := chroma.SplitTokensIntoLines(it.Tokens())
+	for len(tokenLines) > 1 && len(tokenLines[len(tokenLines)-1]) == 0 {
+		tokenLines = tokenLines[:len(tokenLines)-1]
+	}
+
+	numberColor, _ := parseColor(chromaColor(theme.Get(chroma.LineNumbers).Colour, "#7f7f7f"))
+	numberWidth := len(strconv.Itoa(lineStart + len(tokenLines) - 1))
+	lines := make([]textLine, 0, len(tokenLines))
+	for i, tokens := range tokenLines {
+		n := lineStart + i
+		line := textLine{highlight: highlighted.contains(n)}
+		if lineNumbers {
+			line.spans = append(line.spans, textSpan{text: fmt.Sprintf("%*d  ", numberWidth, n), color: numberColor})
+		}
+		col := 0
+		for _, token := range tokens {
+			text := strings.TrimSuffix(token.Value, "\n")
+			if text == "" {
+				continue
+			}
+			text, col = expandTabsAt(text, col, style.tabWidth)
+			// Tokens in the theme's default color take the foreground var
+			c := style.fg
+			if entry := theme.Get(token.Type); entry.Colour.IsSet() && entry.Colour != bg.Colour {
+				c, _ = parseColor(entry.Colour.String())
+			}
+			line.spans = append(line.spans, textSpan{text: text, color: c})
+		}
+		lines = append(lines, line)
+	}
+	return style, lines, nil
+}
+
+// chromaColor returns the chroma color in hex notation, or def when unset
+func chromaColor(c chroma.Colour, def string) string {
+	if !c.IsSet() {
+		return def
+	}
+	return c.String()
+}
+
+// lineRanges are inclusive ranges of line numbers
+type lineRanges [][2]int
+
+func (r lineRanges) contains(n int) bool {
+	for _, lr := range r {
+		if n >= lr[0] && n <= lr[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLineRanges parses line numbers and ranges such as 1,3-5
+func parseLineRanges(s string) (lineRanges, error) {
+	var ranges lineRanges
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(from)
+		end := start
+		if err == nil && isRange {
+			end, err = strconv.Atoi(to)
+		}
+		if err != nil || start < 0 || end < start {
+			return nil, fmt.Errorf("invalid line range %q in highlight", part)
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges, nil
+}
@@ -0,0 +1,101 @@
+package laminate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighlightCode(t *testing.T) {
+	input := "package main\n\nfunc main() {\n\tprintln(1)\n}\n\n"
+	style, lines, err := highlightCode(&builtinRequest{lang: "go", input: input, vars: map[string]string{
+		"line_numbers": "true",
+		"highlight":    "11-12",
+		"line_start":   "9",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer style.face.Close()
+
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 lines without the trailing newlines, got %d", len(lines))
+	}
+	text := func(line textLine) string {
+		var b strings.Builder
+		for _, span := range line.spans {
+			b.WriteString(span.text)
+		}
+		return b.String()
+	}
+	if got, want := text(lines[0]), " 9  package main"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got, want := text(lines[3]), "12      println(1)"; got != want {
+		t.Errorf("Expected the tab to be expanded, got %q", got)
+	}
+	for i, want := range []bool{false, false, true, true, false} {
+		if lines[i].highlight != want {
+			t.Errorf("Expected line %d highlight to be %v", i+9, want)
+		}
+	}
+	// "package" is a keyword, colored unlike plain text
+	if lines[0].spans[1].color == style.fg {
+		t.Errorf("Expected the keyword to be colored, got %v", lines[0].spans[1].color)
+	}
+}
+
+func TestHighlightCode_Lexer(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		req  *builtinRequest
+	}{
+		{"by_language_var", &builtinRequest{lang: "code", input: "def f(): pass", vars: map[string]string{"language": "python"}}},
+		{"by_analysis", &builtinRequest{lang: "unknown", input: "#!/usr/bin/env python\ndef f(): pass"}},
+		{"fallback", &builtinRequest{lang: "unknown", input: "plain text"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			style, lines, err := highlightCode(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			style.face.Close()
+			if len(lines) == 0 {
+				t.Error("Expected lines")
+			}
+		})
+	}
+}
+
+func TestRenderCode_Errors(t *testing.T) {
+	tests := []struct {
+		vars   map[string]string
+		errMsg string
+	}{
+		{map[string]string{"theme": "nope"}, `unknown theme "nope"`},
+		{map[string]string{"highlight": "3-1"}, `invalid line range "3-1"`},
+		{map[string]string{"line_start": "x"}, "line_start must be an integer"},
+	}
+	for _, tt := range tests {
+		_, err := renderCode(&builtinRequest{lang: "go", input: "package main", format: "png", vars: tt.vars})
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("renderCode(%v) error = %v, want %q", tt.vars, err, tt.errMsg)
+		}
+	}
+}
+
+func TestParseLineRanges(t *testing.T) {
+	r, err := parseLineRanges("1, 3-5,8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, want := range map[int]bool{1: true, 2: false, 3: true, 5: true, 6: false, 8: true} {
+		if r.contains(n) != want {
+			t.Errorf("contains(%d) = %v, want %v", n, !want, want)
+		}
+	}
+	for _, s := range []string{"a", "1-", "-1"} {
+		if _, err := parseLineRanges(s); err == nil {
+			t.Errorf("parseLineRanges(%q) expected error", s)
+		}
+	}
+}
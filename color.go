@@ -0,0 +1,52 @@
+package laminate
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// rgba is a non-premultiplied color as written in the config, such as
+// #336699 or white
+type rgba = color.NRGBA
+
+// namedColors are the color names accepted besides hex notation, as 0xRRGGBBAA
+var namedColors = map[string]uint32{
+	"black":       0x000000ff,
+	"white":       0xffffffff,
+	"gray":        0x808080ff,
+	"grey":        0x808080ff,
+	"red":         0xff0000ff,
+	"green":       0x008000ff,
+	"blue":        0x0000ffff,
+	"transparent": 0x00000000,
+}
+
+// hexColor returns the color of 0xRRGGBBAA
+func hexColor(v uint32) rgba {
+	return rgba{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+}
+
+// parseColor parses #rgb, #rrggbb, #rrggbbaa or a color name
+func parseColor(s string) (rgba, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if v, ok := namedColors[s]; ok {
+		return hexColor(v), nil
+	}
+	hex, ok := strings.CutPrefix(s, "#")
+	if !ok {
+		return rgba{}, fmt.Errorf("invalid color %q", s)
+	}
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return rgba{}, fmt.Errorf("invalid color %q", s)
+	}
+	return hexColor(uint32(v)), nil
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/goccy/go-yaml"
@@ -13,8 +14,39 @@ import (
 
 // Config represents the configuration for laminate
 type Config struct {
-	Cache    time.Duration `yaml:"cache"`
-	Commands []*Command    `yaml:"commands"`
+	Cache       time.Duration `yaml:"cache"`
+	Timeout     time.Duration `yaml:"timeout"`
+	Format      string        `yaml:"format"`
+	Quiet       bool          `yaml:"quiet"`
+	Explain     bool          `yaml:"explain"`
+	Diagnostics string        `yaml:"diagnostics"`
+	Wrapper     []string      `yaml:"wrapper"`
+	Commands    []*Command    `yaml:"commands"`
+
+	MaxInputBytes  ByteSize `yaml:"max_input_bytes"`
+	MaxOutputBytes ByteSize `yaml:"max_output_bytes"`
+	Rlimits        *Rlimits `yaml:"rlimits"`
+
+	JPEGQuality    int    `yaml:"jpeg_quality"`
+	PNGCompression string `yaml:"png_compression"`
+
+	workers *workerPool
+}
+
+// Close stops the worker processes started for the config's rules
+func (config *Config) Close() error {
+	if config.workers != nil {
+		config.workers.close()
+	}
+	return nil
+}
+
+// getWorkers returns the config's worker pool, creating it on first use
+func (config *Config) getWorkers() *workerPool {
+	if config.workers == nil {
+		config.workers = &workerPool{}
+	}
+	return config.workers
 }
 
 // RunCommand represents a command that can be either a string or []string
@@ -42,9 +74,53 @@ func (r *RunCommand) UnmarshalYAML(unmarshal func(any) error) error {
 		return nil
 	}
 
+	// Try to unmarshal as an array containing conditional groups
+	var items []any
+	if err := unmarshal(&items); err == nil {
+		array, err := flattenRunArgs(items)
+		if err != nil {
+			return err
+		}
+		r.array = array
+		r.isArray = true
+		return nil
+	}
+
 	return fmt.Errorf("run must be string or array of strings")
 }
 
+// flattenRunArgs turns `{if: var, then: [...]}` groups into plain elements
+// guarded by {{?var}} conditions, so that a group is dropped as a whole when
+// the variable is empty.
+func flattenRunArgs(items []any) ([]string, error) {
+	var args []string
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			args = append(args, v)
+		case map[string]any:
+			cond, _ := v["if"].(string)
+			if !templateVarNameReg.MatchString(cond) {
+				return nil, fmt.Errorf("run: invalid variable name in if: %q", cond)
+			}
+			then, ok := v["then"].([]any)
+			if !ok {
+				return nil, fmt.Errorf("run: if: %s requires a then: array", cond)
+			}
+			inner, err := flattenRunArgs(then)
+			if err != nil {
+				return nil, err
+			}
+			for _, arg := range inner {
+				args = append(args, "{{?"+cond+"}}"+arg)
+			}
+		default:
+			args = append(args, fmt.Sprint(v))
+		}
+	}
+	return args, nil
+}
+
 // IsArray returns true if the command is an array
 func (r *RunCommand) IsArray() bool {
 	return r.isArray
@@ -60,34 +136,227 @@ func (r *RunCommand) Array() []string {
 	return r.array
 }
 
+// VarValue represents a variable value that can be either a string or []string
+type VarValue []string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (v *VarValue) UnmarshalYAML(unmarshal func(any) error) error {
+	var str string
+	if err := unmarshal(&str); err == nil {
+		*v = VarValue{str}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*v = list
+		return nil
+	}
+
+	return fmt.Errorf("vars must be string or array of strings")
+}
+
+// String returns the value as a string, joining list values with spaces
+func (v VarValue) String() string {
+	return strings.Join(v, " ")
+}
+
 // Command represents a single command configuration
 type Command struct {
-	Lang  string     `yaml:"lang"`
-	Run   RunCommand `yaml:"run"`
-	Ext   string     `yaml:"ext"`
-	Shell string     `yaml:"shell"`
+	Lang        string              `yaml:"lang"`
+	Run         RunCommand          `yaml:"run"`
+	Ext         string              `yaml:"ext"`
+	Shell       string              `yaml:"shell"`
+	Vars        map[string]VarValue `yaml:"vars"`
+	Env         map[string]string   `yaml:"env"`
+	Template    string              `yaml:"template"`
+	Formats     []string            `yaml:"formats"`
+	OutputGlob  string              `yaml:"output_glob"`
+	OutputPick  string              `yaml:"output_pick"`
+	Validate    string              `yaml:"validate"`
+	Timeout     time.Duration       `yaml:"timeout"`
+	Retry       *RetryPolicy        `yaml:"retry"`
+	Wrapper     []string            `yaml:"wrapper"`
+	Worker      *WorkerConfig       `yaml:"worker"`
+	Plugin      string              `yaml:"plugin"`
+	Builtin     string              `yaml:"builtin"`
+	Postprocess *Postprocess        `yaml:"postprocess"`
+
+	MaxInputBytes  ByteSize `yaml:"max_input_bytes"`
+	MaxOutputBytes ByteSize `yaml:"max_output_bytes"`
+	Rlimits        *Rlimits `yaml:"rlimits"`
+
+	JPEGQuality    int    `yaml:"jpeg_quality"`
+	PNGCompression string `yaml:"png_compression"`
+	// Convert also converts output in another format than ext to ext
+	Convert bool `yaml:"convert"`
+
+	// Learned from the plugin's handshake
+	handshaken  bool
+	pluginName  string
+	pluginLangs []string
+}
+
+// name returns the rule's name for messages: its lang, or for a plugin
+// without one, the plugin's name or path
+func (cmd *Command) name() string {
+	switch {
+	case cmd.Lang != "" || cmd.Plugin == "":
+		return cmd.Lang
+	case cmd.pluginName != "":
+		return cmd.pluginName
+	}
+	return cmd.Plugin
 }
 
-// GetExt returns the file extension for the output
+// workerArgv returns the argv of the rule's worker or plugin
+func (cmd *Command) workerArgv() []string {
+	if cmd.Plugin != "" {
+		return []string{cmd.Plugin}
+	}
+	return cmd.Worker.Command
+}
+
+// GetExt returns the file extension for the output: ext, or the default
+// format of the builtin, or png
 func (cmd *Command) GetExt() string {
 	if cmd.Ext != "" {
 		return pathologize.Clean(cmd.Ext)
 	}
+	if b, ok := builtins[cmd.Builtin]; ok {
+		return b.formats[0]
+	}
 	return "png"
 }
 
+// getTimeout returns the timeout for the command, which overrides the
+// config-level one. Zero means no timeout.
+func (cmd *Command) getTimeout(config *Config) time.Duration {
+	if cmd.Timeout > 0 {
+		return cmd.Timeout
+	}
+	return config.Timeout
+}
+
+// getWrapper returns the argv prefix for the command. The command's wrapper
+// replaces the config-level one, and an empty list disables it.
+func (cmd *Command) getWrapper(config *Config) []string {
+	if cmd.Wrapper != nil {
+		return cmd.Wrapper
+	}
+	return config.Wrapper
+}
+
+// checkWorkerWrapper rejects a wrapper for a worker or plugin rule. A worker
+// outlives the jobs whose {{...}} variables a wrapper takes, so it cannot be
+// wrapped, and running it unwrapped has to be asked for with `wrapper: []`.
+func (cmd *Command) checkWorkerWrapper(wrapper []string) error {
+	if len(wrapper) == 0 {
+		return nil
+	}
+	return &ConfigError{Err: fmt.Errorf("rule %s: wrapper does not apply to workers and plugins, set `wrapper: []` on the rule to run it unwrapped", cmd.name())}
+}
+
+// SupportsFormat reports whether the command can produce the given format.
+// A command with formats supports those, a builtin those of the renderer;
+// otherwise it supports its ext only. An empty format is always supported.
+func (cmd *Command) SupportsFormat(format string) bool {
+	if format == "" {
+		return true
+	}
+	formats := cmd.Formats
+	if b, ok := builtins[cmd.Builtin]; ok && len(formats) == 0 {
+		_, ok := b.renderFormat(format)
+		return ok
+	}
+	if len(formats) == 0 {
+		return sameFormat(cmd.GetExt(), format)
+	}
+	for _, f := range formats {
+		if sameFormat(f, format) {
+			return true
+		}
+	}
+	return false
+}
+
+// getOutputExt returns the file extension for the output in the requested
+// format, falling back to GetExt when no format is requested. A builtin
+// without ext renders in the format it detects in the input, if any.
+func (cmd *Command) getOutputExt(format, input string) string {
+	if format != "" && cmd.SupportsFormat(format) {
+		return pathologize.Clean(normalizeFormat(format))
+	}
+	if b, ok := builtins[cmd.Builtin]; ok && cmd.Ext == "" {
+		return b.defaultFormat(input)
+	}
+	return cmd.GetExt()
+}
+
+// normalizeFormat lowercases a format name and maps aliases such as jpeg
+// onto the extension used by laminate
+func normalizeFormat(format string) string {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
+
+func sameFormat(a, b string) bool {
+	return normalizeFormat(a) == normalizeFormat(b)
+}
+
+// validateOutput checks the output of the command according to its validate
+// setting: "warn" (default) reports format mismatches as warnings, "strict"
+// fails on them and "off" disables the checks.
+func (cmd *Command) validateOutput(data []byte, ext string) (warning string, err error) {
+	switch cmd.Validate {
+	case "", "warn":
+		return validateOutput(data, ext, false)
+	case "strict":
+		return validateOutput(data, ext, true)
+	case "off":
+		return "", nil
+	}
+	return "", &ConfigError{Err: fmt.Errorf("unknown validate mode: %q", cmd.Validate)}
+}
+
+// templateExpander returns a function expanding templates with the rule's
+// template engine: the built-in {{var}} syntax by default, or text/template
+// when template is "go".
+func (cmd *Command) templateExpander(vars map[string]string, lists map[string][]string) (func(string) (string, error), error) {
+	switch cmd.Template {
+	case "":
+		return func(s string) (string, error) {
+			return ExpandTemplate(s, vars)
+		}, nil
+	case "go":
+		return func(s string) (string, error) {
+			return expandGoTemplate(s, vars, lists)
+		}, nil
+	}
+	return nil, &ConfigError{Err: fmt.Errorf("unknown template engine: %q", cmd.Template)}
+}
+
 // LoadConfig loads the configuration from the config file
 func LoadConfig() (*Config, error) {
 	configPath := getConfigPath()
 
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, &ConfigError{Err: fmt.Errorf("failed to read config file: %w", err)}
 	}
 
 	var config Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		return nil, &ConfigError{Err: fmt.Errorf("failed to parse config file: %w", err)}
+	}
+	if err := config.expandEnv(); err != nil {
+		return nil, &ConfigError{Err: fmt.Errorf("failed to expand config file: %w", err)}
+	}
+	if err := config.addPlugins(filepath.Dir(configPath), getPluginDir()); err != nil {
+		return nil, &ConfigError{Err: err}
 	}
 
 	return &config, nil
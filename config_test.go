@@ -3,6 +3,7 @@ package laminate
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -31,6 +32,33 @@ func TestCommand_GetExt(t *testing.T) {
 	}
 }
 
+func TestCommand_getOutputExt(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmd      *Command
+		format   string
+		expected string
+	}{
+		{"no_format", &Command{Ext: "jpg"}, "", "jpg"},
+		{"no_format_default", &Command{}, "", "png"},
+		{"format_from_list", &Command{Formats: []string{"png", "svg"}}, "svg", "svg"},
+		{"format_alias", &Command{Formats: []string{"jpg"}}, "JPEG", "jpg"},
+		{"unsupported_format", &Command{Ext: "gif"}, "svg", "gif"},
+		{"builtin_default", &Command{Builtin: "text"}, "", "png"},
+		{"builtin_detected", &Command{Builtin: "image"}, "", "svg"},
+		{"builtin_ext", &Command{Builtin: "image", Ext: "png"}, "", "png"},
+		{"builtin_format", &Command{Builtin: "image"}, "jpg", "jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.cmd.getOutputExt(tt.format, `<svg xmlns="http://www.w3.org/2000/svg"></svg>`); result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
 func TestRunCommand_UnmarshalYAML_WithActualYAML(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -50,6 +78,18 @@ func TestRunCommand_UnmarshalYAML_WithActualYAML(t *testing.T) {
 			true,
 			[]string{"echo", "hello"},
 		},
+		{
+			"array_command_with_if_group",
+			`run: ["silicon", {if: theme, then: ["--theme", "{{theme}}"]}, "-o", "{{output}}"]`,
+			true,
+			[]string{"silicon", "{{?theme}}--theme", "{{?theme}}{{theme}}", "-o", "{{output}}"},
+		},
+		{
+			"array_command_with_nested_if_group",
+			`run: ["cmd", {if: a, then: [{if: b, then: ["{{b}}"]}]}]`,
+			true,
+			[]string{"cmd", "{{?a}}{{?b}}{{b}}"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -88,6 +128,48 @@ func TestRunCommand_UnmarshalYAML_WithActualYAML(t *testing.T) {
 	}
 }
 
+func TestRunCommand_UnmarshalYAML_InvalidIfGroup(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"missing_then", `run: ["cmd", {if: theme}]`},
+		{"invalid_variable", `run: ["cmd", {if: "the me", then: ["x"]}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmd struct {
+				Run RunCommand `yaml:"run"`
+			}
+			if err := yaml.Unmarshal([]byte(tt.yaml), &cmd); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestVarValue_UnmarshalYAML(t *testing.T) {
+	var cmd struct {
+		Vars map[string]VarValue `yaml:"vars"`
+	}
+	err := yaml.Unmarshal([]byte(`vars: {theme: Nord, size: 12, include: [/usr/include, /opt/include]}`), &cmd)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]VarValue{
+		"theme":   {"Nord"},
+		"size":    {"12"},
+		"include": {"/usr/include", "/opt/include"},
+	}
+	if !reflect.DeepEqual(cmd.Vars, expected) {
+		t.Errorf("Expected %v, got %v", expected, cmd.Vars)
+	}
+	if s := cmd.Vars["include"].String(); s != "/usr/include /opt/include" {
+		t.Errorf("Expected joined string, got %q", s)
+	}
+}
+
 func TestPathOverride(t *testing.T) {
 	tests := []struct {
 		name     string
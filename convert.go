@@ -0,0 +1,92 @@
+package laminate
+
+import (
+	"fmt"
+	"image/png"
+	"slices"
+)
+
+// encodeOptions are the settings for encoding images in-process
+type encodeOptions struct {
+	jpegQuality    int
+	pngCompression png.CompressionLevel
+}
+
+// defaultJPEGQuality is the JPEG quality used unless jpeg_quality is set
+const defaultJPEGQuality = 90
+
+// pngCompressionLevels maps png_compression settings to levels
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"":        png.DefaultCompression,
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"speed":   png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+// getEncodeOptions returns the encoding settings of the command, which
+// override the config-level ones
+func (cmd *Command) getEncodeOptions(config *Config) (*encodeOptions, error) {
+	quality := defaultJPEGQuality
+	for _, q := range []int{config.JPEGQuality, cmd.JPEGQuality} {
+		if q != 0 {
+			quality = q
+		}
+	}
+	if quality < 1 || quality > 100 {
+		return nil, &ConfigError{Err: fmt.Errorf("jpeg_quality must be between 1 and 100: %d", quality)}
+	}
+	compression := config.PNGCompression
+	if cmd.PNGCompression != "" {
+		compression = cmd.PNGCompression
+	}
+	level, ok := pngCompressionLevels[compression]
+	if !ok {
+		return nil, &ConfigError{Err: fmt.Errorf("png_compression must be default, none, speed or best: %q", compression)}
+	}
+	return &encodeOptions{jpegQuality: quality, pngCompression: level}, nil
+}
+
+// processOutput post-processes the output and converts it to the requested
+// format when the command produced another one of PNG, JPEG and GIF. Only a
+// format requested besides the rule's own ext is converted, unless the rule
+// sets convert or is a builtin, so that a tool writing the wrong format under
+// its ext is still caught by validation. Output that needs neither is returned as is, as is
+// output other than PNG, JPEG and GIF, which cannot be post-processed.
+func (cmd *Command) processOutput(data []byte, ext string, opts *encodeOptions, diag *diagnostics) ([]byte, error) {
+	detected, want := detectFormat(data), normalizeFormat(ext)
+	convert := detected != want && slices.Contains(rasterFormats, detected) && slices.Contains(rasterFormats, want) &&
+		(cmd.Builtin != "" || cmd.Convert || !sameFormat(want, cmd.GetExt()))
+	postprocess := cmd.Postprocess != nil
+	if postprocess && !slices.Contains(rasterFormats, detected) {
+		diag.explainf("skipping post-processing, which applies to PNG, JPEG and GIF only")
+		postprocess = false
+	}
+	if !postprocess && !convert {
+		return data, nil
+	}
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	if postprocess {
+		diag.explainf("post-processing the output")
+		if img, err = cmd.Postprocess.process(img); err != nil {
+			return nil, fmt.Errorf("postprocess failed: %w", err)
+		}
+	}
+	if convert {
+		diag.explainf("converting the %s output to %s", format, want)
+		format = want
+	}
+	return encodeImage(img, format, opts)
+}
+
+// cacheKey returns the part of the cache key for the settings, which is empty
+// for the defaults so that existing cache entries stay valid
+func (opts *encodeOptions) cacheKey() string {
+	if opts.jpegQuality == defaultJPEGQuality && opts.pngCompression == png.DefaultCompression {
+		return ""
+	}
+	return fmt.Sprintf("\x00jpeg_quality=%d\x00png_compression=%d", opts.jpegQuality, opts.pngCompression)
+}
@@ -0,0 +1,125 @@
+package laminate
+
+import (
+	"bytes"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestCommand_processOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmd   *Command
+		input string // format of the command's output
+		ext   string
+		want  string
+		width int
+	}{
+		{name: "as_is", cmd: &Command{}, input: "png", ext: "png", want: "png", width: 4},
+		{name: "png_to_jpg", cmd: &Command{}, input: "png", ext: "jpg", want: "jpg", width: 4},
+		{name: "jpg_to_png", cmd: &Command{Ext: "jpg"}, input: "jpg", ext: "png", want: "png", width: 4},
+		{name: "mismatch_under_own_ext", cmd: &Command{}, input: "jpg", ext: "png", want: "jpg"},
+		{name: "convert_to_own_ext", cmd: &Command{Convert: true}, input: "jpg", ext: "png", want: "png", width: 4},
+		{name: "builtin_converted", cmd: &Command{Builtin: "text"}, input: "png", ext: "jpg", want: "jpg", width: 4},
+		{name: "png_to_gif", cmd: &Command{}, input: "png", ext: "gif", want: "gif", width: 4},
+		{name: "jpeg_alias", cmd: &Command{}, input: "png", ext: "jpeg", want: "jpg", width: 4},
+		{name: "postprocess_keeps_format", cmd: &Command{Postprocess: &Postprocess{Padding: 2}}, input: "gif", ext: "gif", want: "gif", width: 8},
+		{name: "postprocess_and_convert", cmd: &Command{Postprocess: &Postprocess{Padding: 2}}, input: "png", ext: "jpg", want: "jpg", width: 8},
+		{name: "non_raster_untouched", cmd: &Command{}, input: "svg", ext: "png", want: "svg"},
+		{name: "postprocess_skips_non_raster", cmd: &Command{Postprocess: &Postprocess{Padding: 2}}, input: "svg", ext: "svg", want: "svg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+			if tt.input != "svg" {
+				data = encodeTestImage(t, tt.input)
+			}
+			got, err := tt.cmd.processOutput(data, tt.ext, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f := detectFormat(got); f != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, f)
+			}
+			if tt.width == 0 {
+				return
+			}
+			img, _, err := decodeImage(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != tt.width {
+				t.Errorf("Expected width %d, got %d", tt.width, img.Bounds().Dx())
+			}
+		})
+	}
+}
+
+func TestCommand_getEncodeOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		cmd     *Command
+		quality int
+		errMsg  string
+	}{
+		{name: "default", config: &Config{}, cmd: &Command{}, quality: defaultJPEGQuality},
+		{name: "config", config: &Config{JPEGQuality: 50}, cmd: &Command{}, quality: 50},
+		{name: "command_overrides", config: &Config{JPEGQuality: 50}, cmd: &Command{JPEGQuality: 70}, quality: 70},
+		{name: "quality_out_of_range", config: &Config{JPEGQuality: 101}, cmd: &Command{}, errMsg: "jpeg_quality must be between 1 and 100"},
+		{name: "compression", config: &Config{PNGCompression: "best"}, cmd: &Command{PNGCompression: "speed"}, quality: defaultJPEGQuality},
+		{name: "unknown_compression", config: &Config{}, cmd: &Command{PNGCompression: "max"}, errMsg: "png_compression must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.cmd.getEncodeOptions(tt.config)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.jpegQuality != tt.quality {
+				t.Errorf("Expected quality %d, got %d", tt.quality, opts.jpegQuality)
+			}
+		})
+	}
+}
+
+func TestEncodeImage_JPEGQuality(t *testing.T) {
+	img, _, err := decodeImage(encodeTestImage(t, "png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = newTestImage(64, 64, img.Bounds().Add(img.Bounds().Max))
+	low, err := encodeImage(img, "jpg", &encodeOptions{jpegQuality: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	high, err := encodeImage(img, "jpg", &encodeOptions{jpegQuality: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(low) >= len(high) {
+		t.Errorf("Expected lower quality to be smaller, got %d and %d bytes", len(low), len(high))
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(low)); err != nil {
+		t.Errorf("Expected a valid JPEG, got %v", err)
+	}
+}
+
+func TestEncodeOptions_cacheKey(t *testing.T) {
+	if key := (&encodeOptions{jpegQuality: defaultJPEGQuality, pngCompression: png.DefaultCompression}).cacheKey(); key != "" {
+		t.Errorf("Expected no key for the defaults, got %q", key)
+	}
+	a := (&encodeOptions{jpegQuality: 50}).cacheKey()
+	b := (&encodeOptions{jpegQuality: 60}).cacheKey()
+	if a == "" || a == b {
+		t.Errorf("Expected distinct keys, got %q and %q", a, b)
+	}
+}
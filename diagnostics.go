@@ -0,0 +1,150 @@
+package laminate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// diagnostics reports warnings, the output of successful commands and errors,
+// either as plain text or as JSON lines.
+type diagnostics struct {
+	w       io.Writer
+	json    bool
+	quiet   bool
+	explain bool
+}
+
+// diagnosticRecord is a JSON diagnostics line
+type diagnosticRecord struct {
+	Level      string   `json:"level"`
+	Message    string   `json:"message"`
+	Rule       *string  `json:"rule,omitempty"`
+	Argv       []string `json:"argv,omitempty"`
+	ExitStatus *int     `json:"exit_status,omitempty"`
+	ExitCode   int      `json:"exit_code,omitempty"`
+	Stdout     string   `json:"stdout,omitempty"`
+	Stderr     string   `json:"stderr,omitempty"`
+}
+
+// newDiagnostics returns diagnostics writing to the log output, which Run
+// points at its error stream
+func newDiagnostics(config *Config) *diagnostics {
+	return &diagnostics{
+		w:       log.Writer(),
+		json:    config.Diagnostics == "json",
+		quiet:   config.Quiet,
+		explain: config.Explain,
+	}
+}
+
+// setFormat sets the diagnostics format: "text" (default) or "json"
+func (d *diagnostics) setFormat(format string) error {
+	switch format {
+	case "", "text":
+		d.json = false
+	case "json":
+		d.json = true
+	default:
+		return fmt.Errorf("unknown diagnostics format: %q", format)
+	}
+	return nil
+}
+
+func (d *diagnostics) writer() io.Writer {
+	if d == nil || d.w == nil {
+		return log.Writer()
+	}
+	return d.w
+}
+
+func (d *diagnostics) writeRecord(r *diagnosticRecord) {
+	b, _ := json.Marshal(r)
+	fmt.Fprintf(d.writer(), "%s\n", b)
+}
+
+// warn reports a warning. Warnings are shown even in quiet mode.
+func (d *diagnostics) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if d != nil && d.json {
+		d.writeRecord(&diagnosticRecord{Level: "warning", Message: msg})
+		return
+	}
+	fmt.Fprintf(d.writer(), "Warning: %s\n", msg)
+}
+
+// explainf reports a step laminate takes, when explaining is enabled
+func (d *diagnostics) explainf(format string, args ...any) {
+	if d == nil || !d.explain {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if d.json {
+		d.writeRecord(&diagnosticRecord{Level: "debug", Message: msg})
+		return
+	}
+	fmt.Fprintf(d.writer(), "laminate: %s\n", msg)
+}
+
+// commandOutput reports what a successful command wrote to stderr, and to
+// stdout when the result was read from a file. Nothing is shown in quiet mode.
+func (d *diagnostics) commandOutput(rule string, stdout, stderr string) {
+	if (d != nil && d.quiet) || (stdout == "" && stderr == "") {
+		return
+	}
+	if d != nil && d.json {
+		d.writeRecord(&diagnosticRecord{
+			Level:   "info",
+			Message: "command output",
+			Rule:    &rule,
+			Stdout:  stdout,
+			Stderr:  stderr,
+		})
+		return
+	}
+	fmt.Fprint(d.writer(), stdout, stderr)
+}
+
+// reportError writes err as a JSON diagnostics line
+func (d *diagnostics) reportError(err error) {
+	r := &diagnosticRecord{Level: "error", Message: err.Error(), ExitCode: 1}
+	var ecoder interface{ ExitCode() int }
+	if errors.As(err, &ecoder) {
+		r.ExitCode = ecoder.ExitCode()
+	}
+	var cerr *CommandError
+	if errors.As(err, &cerr) {
+		r.Message = fmt.Sprintf("command failed: %s: %v", cerr.Argv[0], cerr.Err)
+		r.Rule, r.Argv, r.ExitStatus, r.Stderr = &cerr.Rule, cerr.Argv, &cerr.ExitStatus, cerr.Stderr
+	}
+	d.writeRecord(r)
+}
+
+// reportedError wraps an error that has already been reported as a JSON
+// diagnostics line
+type reportedError struct {
+	error
+}
+
+func (e *reportedError) Unwrap() error {
+	return e.error
+}
+
+// IsReported reports whether err has already been written to the error stream
+// by Run, so that the caller should not print it again
+func IsReported(err error) bool {
+	var rerr *reportedError
+	return errors.As(err, &rerr)
+}
+
+// formatStderr returns the stderr tail for inclusion in an error message
+func formatStderr(stderr string) string {
+	stderr = strings.TrimRight(stderr, "\n")
+	if stderr == "" {
+		return ""
+	}
+	return "\nstderr:\n" + stderr
+}
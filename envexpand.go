@@ -0,0 +1,104 @@
+package laminate
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+var envVarPattern = regexp.MustCompile(`\$(\$?)\{([a-zA-Z_][a-zA-Z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv expands ${VAR} and ${VAR:-default} in s. ${VAR} requires VAR to
+// be set; the default is used when VAR is unset or empty. $${VAR} is left as
+// the literal ${VAR}. Other forms, such as $VAR or ${VAR%.*}, are untouched so
+// that shell commands and {{...}} templates keep their meaning.
+func expandEnv(s string) (string, error) {
+	var missing []string
+	result := envVarPattern.ReplaceAllStringFunc(s, func(match string) string {
+		m := envVarPattern.FindStringSubmatchIndex(match)
+		if m[3] > m[2] { // escaped by $$
+			return match[1:]
+		}
+		name, hasDefault := match[m[4]:m[5]], m[6] >= 0
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+		if hasDefault {
+			return match[m[6]:m[7]]
+		}
+		if _, ok := os.LookupEnv(name); !ok {
+			missing = append(missing, name)
+		}
+		return ""
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", missing[0])
+	}
+	return result, nil
+}
+
+// expandEnv expands environment variables in the string fields of the
+// configuration: run, wrapper, worker command, plugin, shell, ext, env and
+// vars. Shell variables in a run string are written as $${VAR} or $VAR.
+func (config *Config) expandEnv() error {
+	for j, v := range config.Wrapper {
+		v, err := expandEnv(v)
+		if err != nil {
+			return fmt.Errorf("wrapper[%d]: %w", j, err)
+		}
+		config.Wrapper[j] = v
+	}
+	for i, cmd := range config.Commands {
+		expand := func(field string, s *string) error {
+			v, err := expandEnv(*s)
+			if err != nil {
+				return fmt.Errorf("commands[%d].%s: %w", i, field, err)
+			}
+			*s = v
+			return nil
+		}
+		if err := expand("run", &cmd.Run.str); err != nil {
+			return err
+		}
+		for j := range cmd.Run.array {
+			if err := expand(fmt.Sprintf("run[%d]", j), &cmd.Run.array[j]); err != nil {
+				return err
+			}
+		}
+		for j := range cmd.Wrapper {
+			if err := expand(fmt.Sprintf("wrapper[%d]", j), &cmd.Wrapper[j]); err != nil {
+				return err
+			}
+		}
+		if cmd.Worker != nil {
+			for j := range cmd.Worker.Command {
+				if err := expand(fmt.Sprintf("worker.command[%d]", j), &cmd.Worker.Command[j]); err != nil {
+					return err
+				}
+			}
+		}
+		if err := expand("plugin", &cmd.Plugin); err != nil {
+			return err
+		}
+		if err := expand("shell", &cmd.Shell); err != nil {
+			return err
+		}
+		if err := expand("ext", &cmd.Ext); err != nil {
+			return err
+		}
+		for k, v := range cmd.Env {
+			if err := expand("env."+k, &v); err != nil {
+				return err
+			}
+			cmd.Env[k] = v
+		}
+		for k, values := range cmd.Vars {
+			for j := range values {
+				if err := expand("vars."+k, &values[j]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
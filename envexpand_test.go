@@ -0,0 +1,115 @@
+package laminate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("LAMINATE_TEST_DIR", "/opt/fonts")
+	t.Setenv("LAMINATE_TEST_EMPTY", "")
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		hasError bool
+	}{
+		{"no_variables", "echo hello", "echo hello", false},
+		{"set_variable", "--font-dir=${LAMINATE_TEST_DIR}", "--font-dir=/opt/fonts", false},
+		{"default_unused", "${LAMINATE_TEST_DIR:-/usr/share}", "/opt/fonts", false},
+		{"default_for_unset", "${LAMINATE_TEST_UNSET:-/usr/share}", "/usr/share", false},
+		{"default_for_empty", "${LAMINATE_TEST_EMPTY:-fallback}", "fallback", false},
+		{"empty_default", "[${LAMINATE_TEST_UNSET:-}]", "[]", false},
+		{"set_but_empty", "[${LAMINATE_TEST_EMPTY}]", "[]", false},
+		{"missing_required", "${LAMINATE_TEST_UNSET}", "", true},
+		{"escaped", "$${LAMINATE_TEST_UNSET}", "${LAMINATE_TEST_UNSET}", false},
+		{"plain_dollar_untouched", "echo $HOME $$", "echo $HOME $$", false},
+		{"shell_expansion_untouched", "${file%.*}", "${file%.*}", false},
+		{"template_untouched", `-o "{{output}}" ${LAMINATE_TEST_DIR}/{{input}}`, `-o "{{output}}" /opt/fonts/{{input}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := expandEnv(tt.input)
+			if tt.hasError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ExpandEnv(t *testing.T) {
+	t.Setenv("LAMINATE_TEST_THEME_DIR", "/home/me/themes")
+	t.Setenv("LAMINATE_TEST_SHELL", "/bin/zsh")
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	content := `commands:
+- lang: go
+  run: ['silicon', '--theme-dir', '${LAMINATE_TEST_THEME_DIR}', '-o', '{{output}}']
+  shell: ${LAMINATE_TEST_SHELL}
+  ext: ${LAMINATE_TEST_EXT:-jpg}
+  env:
+    FONT_DIR: ${LAMINATE_TEST_FONT_DIR:-/usr/share/fonts}
+  vars:
+    include: ['${LAMINATE_TEST_THEME_DIR}/a', b]
+`
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+	t.Setenv("LAMINATE_CONFIG_PATH", configFile)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cmd := config.Commands[0]
+	if got := cmd.Run.Array()[2]; got != "/home/me/themes" {
+		t.Errorf("Expected expanded run, got %q", got)
+	}
+	if got := cmd.Run.Array()[4]; got != "{{output}}" {
+		t.Errorf("Expected template to be kept, got %q", got)
+	}
+	if cmd.Shell != "/bin/zsh" {
+		t.Errorf("Expected expanded shell, got %q", cmd.Shell)
+	}
+	if cmd.GetExt() != "jpg" {
+		t.Errorf("Expected expanded ext, got %q", cmd.GetExt())
+	}
+	if got := cmd.Env["FONT_DIR"]; got != "/usr/share/fonts" {
+		t.Errorf("Expected expanded env, got %q", got)
+	}
+	if got := cmd.Vars["include"][0]; got != "/home/me/themes/a" {
+		t.Errorf("Expected expanded vars, got %q", got)
+	}
+
+	// Shell variables set by the script are escaped
+	script := `for f in *.txt; do cat "$${f}" ${LAMINATE_TEST_SHELL}; done`
+	if err := os.WriteFile(configFile, []byte("commands:\n- lang: go\n  run: '"+script+"'\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := config.Commands[0].Run.String(), `for f in *.txt; do cat "${f}" /bin/zsh; done`; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	if err := os.WriteFile(configFile, []byte("commands:\n- lang: go\n  run: 'cmd ${LAMINATE_TEST_UNSET}'\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected error for missing environment variable, got nil")
+	}
+}
@@ -0,0 +1,93 @@
+package laminate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Exit codes returned by the laminate command for each error type. Any other
+// error exits with 1.
+const (
+	exitCodeConfig  = 2
+	exitCodeNoMatch = 3
+	exitCodeCommand = 4
+	exitCodeTimeout = 124
+)
+
+// ConfigError is returned when the configuration cannot be loaded or is invalid
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code for the error
+func (e *ConfigError) ExitCode() int {
+	return exitCodeConfig
+}
+
+// NoMatchError is returned when no command matches the language and format
+type NoMatchError struct {
+	Lang   string
+	Format string
+}
+
+func (e *NoMatchError) Error() string {
+	if e.Format != "" {
+		return fmt.Sprintf("no matching command found for language: %s (format: %s)", e.Lang, e.Format)
+	}
+	return fmt.Sprintf("no matching command found for language: %s", e.Lang)
+}
+
+// ExitCode returns the exit code for the error
+func (e *NoMatchError) ExitCode() int {
+	return exitCodeNoMatch
+}
+
+// CommandError is returned when the external command fails
+type CommandError struct {
+	Rule       string   // lang pattern of the matched rule
+	Argv       []string // command line that was run
+	ExitStatus int      // exit status of the command, -1 if it did not exit normally
+	Stderr     string   // tail of the command's stderr
+	Err        error
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command failed: %s: %v", e.Argv[0], e.Err) + formatStderr(e.Stderr)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code for the error
+func (e *CommandError) ExitCode() int {
+	return exitCodeCommand
+}
+
+// TimeoutError is returned when the external command does not finish in time
+type TimeoutError struct {
+	Rule    string
+	Argv    []string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("command timed out after %s: %s", e.Timeout, strings.Join(e.Argv, " "))
+	}
+	return fmt.Sprintf("command timed out: %s", strings.Join(e.Argv, " "))
+}
+
+// ExitCode returns the exit code for the error
+func (e *TimeoutError) ExitCode() int {
+	return exitCodeTimeout
+}
@@ -0,0 +1,29 @@
+package laminate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTailBuffer(t *testing.T) {
+	tb := newTailBuffer(8)
+	tb.Write([]byte("abc"))
+	if got := tb.String(); got != "abc" {
+		t.Errorf("Expected %q, got %q", "abc", got)
+	}
+	tb.Write([]byte("defgh"))
+	if got := tb.String(); got != "abcdefgh" {
+		t.Errorf("Expected %q, got %q", "abcdefgh", got)
+	}
+	tb.Write([]byte("ij"))
+	if got := tb.String(); got != "cdefghij" {
+		t.Errorf("Expected %q, got %q", "cdefghij", got)
+	}
+	n, _ := tb.Write([]byte(strings.Repeat("x", 10) + "12345678"))
+	if n != 18 {
+		t.Errorf("Expected to report 18 bytes written, got %d", n)
+	}
+	if got := tb.String(); got != "12345678" {
+		t.Errorf("Expected %q, got %q", "12345678", got)
+	}
+}
@@ -1,15 +1,19 @@
 package laminate
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/k1LoW/exec"
 )
@@ -20,78 +24,432 @@ type Executor struct {
 	lang   string
 	input  string
 	output string
+	attrs  map[string][]string
+	dir    string // temporary directory the command may write to
+
+	wrapper   []string
+	timeout   time.Duration
+	maxOutput ByteSize
+	rlimits   *Rlimits
+	workers   *workerPool
+	diag      *diagnostics
+}
+
+// killGracePeriod is how long a command may take to exit after it is asked to
+// terminate, on cancellation or timeout, before it is killed
+const killGracePeriod = 3 * time.Second
+
+// stderrTailSize is the size of the captured tail of the command's stderr,
+// and of its stdout when the result is read from a file
+const stderrTailSize = 32 * 1024
+
+// inputFile returns the path of the file holding a copy of the input
+func (e *Executor) inputFile() string {
+	if e.dir == "" {
+		return ""
+	}
+	return filepath.Join(e.dir, "input.txt")
 }
 
 // Execute runs the command and returns the output
 func (e *Executor) Execute(ctx context.Context) ([]byte, error) {
-	argv, err := e.getArgv()
+	if e.cmd.Builtin != "" {
+		return e.executeBuiltin()
+	}
+	if f := e.inputFile(); f != "" {
+		if err := os.WriteFile(f, []byte(e.input), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write input file: %w", err)
+		}
+	}
+	if e.cmd.Worker != nil || e.cmd.Plugin != "" {
+		return e.executeWorker(ctx)
+	}
+	argv, err := e.getWrappedArgv()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get command arguments: %w", err)
 	}
-	return e.exceute(ctx, argv)
+	env, err := e.getEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command environment: %w", err)
+	}
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	attempts := 1
+	if e.cmd.Retry != nil {
+		attempts = max(e.cmd.Retry.Attempts, 1)
+	}
+	for attempt := 1; ; attempt++ {
+		e.diag.explainf("attempt %d/%d: running %q", attempt, attempts, argv)
+		// Do not mistake a partial file from a failed attempt for the result
+		os.Remove(e.output)
+		data, err := e.exceute(ctx, argv, env)
+		if err == nil {
+			return data, nil
+		}
+		e.diag.explainf("attempt %d/%d failed: %v", attempt, attempts, err)
+
+		wait, retry, rerr := e.cmd.Retry.shouldRetry(attempt, err)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if !retry {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			e.diag.explainf("not retrying: the deadline would pass during the %s backoff", wait)
+			return nil, err
+		}
+		e.diag.explainf("retrying in %s", wait)
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil, fmt.Errorf("command interrupted: %w", ctx.Err())
+			}
+			return nil, err
+		case <-time.After(wait):
+		}
+	}
 }
 
-func (e *Executor) getArgv() ([]string, error) {
-	vars := map[string]string{
-		"input":  e.input,
-		"output": e.output,
-		"lang":   e.lang,
+// executeWorker sends the job to the rule's worker or plugin process, which
+// gets the rule's vars overridden by the info string attributes.
+func (e *Executor) executeWorker(ctx context.Context) ([]byte, error) {
+	if err := e.cmd.checkWorkerWrapper(e.wrapper); err != nil {
+		return nil, err
+	}
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	vars := make(map[string][]string, len(e.cmd.Vars)+len(e.attrs))
+	for k, v := range e.cmd.Vars {
+		vars[k] = v
+	}
+	maps.Copy(vars, e.attrs)
+	req := &workerRequest{
+		Lang:   e.lang,
+		Input:  e.input,
+		Format: strings.TrimPrefix(filepath.Ext(e.output), "."),
+		Vars:   vars,
+	}
+	if e.cmd.Plugin != "" {
+		req.Type = "render"
+	}
+	argv := e.cmd.workerArgv()
+	e.diag.explainf("sending the job to worker %q", argv)
+	res, err := e.workers.render(ctx, e.cmd, req, e.rlimits, e.diag)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, &TimeoutError{Rule: e.cmd.name(), Argv: argv, Timeout: e.timeout}
 	}
+	if err != nil {
+		return nil, err
+	}
+	var diagnostics strings.Builder
+	for _, line := range res.Diagnostics {
+		diagnostics.WriteString(line + "\n")
+	}
+	e.diag.commandOutput(e.cmd.name(), "", diagnostics.String())
+	if e.maxOutput > 0 && len(res.Data) > int(e.maxOutput) {
+		return nil, fmt.Errorf("output exceeds max_output_bytes (%d bytes)", e.maxOutput)
+	}
+	if err := checkContentType(res.ContentType, req.Format); err != nil {
+		return nil, err
+	}
+	return res.Data, nil
+}
+
+// executeBuiltin renders in-process with the rule's builtin renderer, which
+// gets the rule's vars overridden by the info string attributes, except for
+// the vars naming files
+func (e *Executor) executeBuiltin() ([]byte, error) {
+	b, err := getBuiltin(e.cmd.Builtin)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.TrimPrefix(filepath.Ext(e.output), ".")
+	format, ok := b.renderFormat(ext)
+	if !ok {
+		return nil, &ConfigError{Err: fmt.Errorf("builtin %s cannot produce %s, only %s", e.cmd.Builtin, ext, strings.Join(b.formats, ", "))}
+	}
+	vars := make(map[string]string, len(e.cmd.Vars)+len(e.attrs))
+	for k, v := range e.cmd.Vars {
+		vars[k] = v.String()
+	}
+	for k, v := range e.attrs {
+		if slices.Contains(builtinPathVars, k) {
+			e.diag.warn("ignoring the %s attribute: files are only taken from the rule's vars", k)
+			continue
+		}
+		vars[k] = strings.Join(v, " ")
+	}
+	e.diag.explainf("rendering with builtin %s", e.cmd.Builtin)
+	data, err := b.render(&builtinRequest{lang: e.lang, input: e.input, format: format, vars: vars})
+	if err != nil {
+		return nil, fmt.Errorf("builtin %s: %w", e.cmd.Builtin, err)
+	}
+	if e.maxOutput > 0 && len(data) > int(e.maxOutput) {
+		return nil, fmt.Errorf("output exceeds max_output_bytes (%d bytes)", e.maxOutput)
+	}
+	return data, nil
+}
+
+// getVars returns the template variables: the rule's vars, overridden by the
+// info string attributes, overridden by the built-in variables. Besides the
+// scalar form it returns every variable as a list for splat expansion.
+func (e *Executor) getVars() (vars map[string]string, lists map[string][]string) {
+	lists = make(map[string][]string, len(e.cmd.Vars)+len(e.attrs)+3)
+	for k, v := range e.cmd.Vars {
+		lists[k] = v
+	}
+	maps.Copy(lists, e.attrs)
+	lists["input"] = []string{e.input}
+	lists["output"] = []string{e.output}
+	lists["lang"] = []string{e.lang}
+	lists["format"] = []string{strings.TrimPrefix(filepath.Ext(e.output), ".")}
+	lists["tmpdir"] = []string{e.dir}
+	lists["inputfile"] = []string{e.inputFile()}
+
+	vars = make(map[string]string, len(lists))
+	for k, v := range lists {
+		vars[k] = strings.Join(v, " ")
+	}
+	return vars, lists
+}
+
+func (e *Executor) getArgv() ([]string, error) {
 	if e.cmd.Run.IsArray() {
-		templates := e.cmd.Run.Array()
-		var result = make([]string, len(templates))
-		for i, template := range templates {
-			expanded, err := ExpandTemplate(template, vars)
-			if err != nil {
-				return nil, err
-			}
-			result[i] = expanded
+		result, err := e.expandArgs(e.cmd.Run.Array())
+		if err != nil {
+			return nil, err
+		}
+		if len(result) == 0 {
+			return nil, fmt.Errorf("command is empty after expanding conditional arguments")
 		}
 		return result, nil
 	}
-	expanded, err := ExpandTemplate(e.cmd.Run.String(), vars)
+	vars, lists := e.getVars()
+	expand, err := e.cmd.templateExpander(vars, lists)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := expand(e.cmd.Run.String())
 	if err != nil {
 		return nil, err
 	}
 	return e.cmd.buildCommand(expanded)
 }
 
-func (e *Executor) exceute(ctx context.Context, argv []string) ([]byte, error) {
-	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
-	cmd.Stderr = os.Stderr
+// getWrappedArgv returns the argv from getArgv prefixed by the wrapper, such
+// as a sandbox, when one is configured. The wrapper is shared by rules of
+// either template engine, so it is always expanded with the built-in one.
+func (e *Executor) getWrappedArgv() ([]string, error) {
+	argv, err := e.getArgv()
+	if err != nil || len(e.wrapper) == 0 {
+		return argv, err
+	}
+	vars, lists := e.getVars()
+	expand := func(s string) (string, error) {
+		return ExpandTemplate(s, vars)
+	}
+	var wrapper []string
+	for _, template := range e.wrapper {
+		args, err := expandArg(template, vars, lists, expand)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand wrapper: %w", err)
+		}
+		wrapper = append(wrapper, args...)
+	}
+	return append(wrapper, argv...), nil
+}
+
+// expandArgs expands array-form templates into argv elements
+func (e *Executor) expandArgs(templates []string) ([]string, error) {
+	vars, lists := e.getVars()
+	expand, err := e.cmd.templateExpander(vars, lists)
+	if err != nil {
+		return nil, err
+	}
+	var result = make([]string, 0, len(templates))
+	for _, template := range templates {
+		expanded, err := expandArg(template, vars, lists, expand)
+		if err != nil {
+			return nil, err
+		}
+		for _, arg := range expanded {
+			// With text/template, conditional arguments are written as
+			// {{if .theme}}--theme={{.theme}}{{end}}, so drop empty results.
+			if arg == "" && e.cmd.Template == "go" {
+				continue
+			}
+			result = append(result, arg)
+		}
+	}
+	return result, nil
+}
+
+// getEnv returns the environment for the command: the current environment
+// plus the rule's env, whose values are expanded as templates.
+func (e *Executor) getEnv() ([]string, error) {
+	if len(e.cmd.Env) == 0 {
+		return nil, nil
+	}
+	vars, lists := e.getVars()
+	expand, err := e.cmd.templateExpander(vars, lists)
+	if err != nil {
+		return nil, err
+	}
+	env := os.Environ()
+	for _, k := range slices.Sorted(maps.Keys(e.cmd.Env)) {
+		v, err := expand(e.cmd.Env[k])
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, k+"="+v)
+	}
+	return env, nil
+}
+
+func (e *Executor) exceute(ctx context.Context, argv, env []string) ([]byte, error) {
+	runArgv := argv
+	if !e.rlimits.isZero() {
+		prefix, err := rlimitArgv(e.rlimits)
+		if err != nil {
+			return nil, err
+		}
+		runArgv = append(prefix, argv...)
+	}
+	cmd := exec.CommandContext(ctx, runArgv[0], runArgv[1:]...)
+	cmd.Env = env
+	stderr := newTailBuffer(stderrTailSize)
+	cmd.Stderr = stderr
 	cmd.Stdin = strings.NewReader(e.input)
-	var buf bytes.Buffer
-	cmd.Stdout = &buf
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("command failed: %w", err)
+	buf := &limitedBuffer{limit: e.maxOutput}
+	cmd.Stdout = buf
+	if e.cmd.OutputGlob != "" {
+		// Tools that choose their own file names usually write to the
+		// current directory, so run them inside the temporary directory.
+		cmd.Dir = e.dir
+	}
+	// On cancellation, ask the whole process group to terminate and kill
+	// it when it does not exit within the grace period.
+	exited := make(chan struct{})
+	cmd.Cancel = func() error {
+		go func() {
+			select {
+			case <-exited:
+			case <-time.After(killGracePeriod):
+				exec.KillCommand(cmd)
+			}
+		}()
+		return exec.TerminateCommand(cmd, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = killGracePeriod + time.Second
+	err := cmd.Start()
+	if err == nil {
+		err = cmd.Wait()
+		close(exited)
+	}
+	if buf.exceeded {
+		// The command may also have died of SIGPIPE, so check this first
+		return nil, fmt.Errorf("output exceeds max_output_bytes (%d bytes)", e.maxOutput)
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, &TimeoutError{Rule: e.cmd.name(), Argv: argv, Timeout: e.timeout}
+		}
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, fmt.Errorf("command interrupted: %w", ctx.Err())
+		}
+		exitStatus := -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitStatus = exitErr.ExitCode()
+		}
+		return nil, &CommandError{
+			Rule:       e.cmd.name(),
+			Argv:       argv,
+			ExitStatus: exitStatus,
+			Stderr:     stderr.String(),
+			Err:        err,
+		}
 	}
 
-	// If the result is written to a temporary file, read it from that file.
-	if b, err := os.ReadFile(e.output); err == nil {
-		fmt.Fprint(os.Stderr, buf.String())
+	// The result is read from a file when output_glob is set, or when the
+	// command wrote it to {{output}}; stdout is then just diagnostics.
+	path := e.output
+	if e.cmd.OutputGlob != "" {
+		var err error
+		path, err = e.cmd.globOutput(e.dir, e.inputFile())
+		if err != nil {
+			return nil, fmt.Errorf("%w%s", err, formatStderr(stderr.String()))
+		}
+	}
+	b, err := e.readOutputFile(path)
+	if err == nil {
+		stdout := newTailBuffer(stderrTailSize)
+		stdout.Write(buf.Bytes())
+		e.diag.commandOutput(e.cmd.name(), stdout.String(), stderr.String())
 		return b, nil
-	} else if !os.IsNotExist(err) {
-		return nil, fmt.Errorf("failed to read output file: %w\nstdout: %s", err, buf.String())
+	}
+	if !os.IsNotExist(err) || e.cmd.OutputGlob != "" {
+		return nil, fmt.Errorf("failed to read output file: %w", err)
 	}
 	// If it does not exist, read the result from stdout.
+	e.diag.commandOutput(e.cmd.name(), "", stderr.String())
 	return buf.Bytes(), nil
 }
 
+// readOutputFile reads the file the command wrote its result to, refusing to
+// read it when it exceeds the output size limit
+func (e *Executor) readOutputFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := readLimited(f, e.maxOutput)
+	if errors.Is(err, errSizeLimit) {
+		return nil, fmt.Errorf("output exceeds max_output_bytes (%d bytes)", e.maxOutput)
+	}
+	return b, err
+}
+
 // ExecuteWithCache executes a command with caching support
+// The lang is the code block info string: a language optionally followed by
+// attributes, as in `go theme=Dracula`, which are exposed as template variables.
+// The output format is taken from config.Format; when set, the first command
+// supporting both the language and the format is used.
 func ExecuteWithCache(ctx context.Context, config *Config, lang, input string, output io.Writer) error {
-	cmd, err := FindMatchingCommand(config.Commands, lang)
+	lang, attrs := parseInfoString(lang)
+	diag := newDiagnostics(config)
+	cmd, err := config.findCommand(ctx, lang, diag)
+	if err != nil {
+		return err
+	}
+	if maxInput := cmd.getMaxInputBytes(config); maxInput > 0 && len(input) > int(maxInput) {
+		return fmt.Errorf("input exceeds max_input_bytes (%d bytes)", maxInput)
+	}
+	ext := cmd.getOutputExt(config.Format, input)
+	opts, err := cmd.getEncodeOptions(config)
 	if err != nil {
 		return err
 	}
-	ext := cmd.GetExt()
+	diag.explainf("language %q matched the rule %q, output format %s", lang, cmd.name(), ext)
 
 	cache := NewCache(config.Cache)
-	if data, found := cache.Get(lang, input, ext); found {
+	key := cacheInput(input, attrs) + cmd.Postprocess.cacheKey() + opts.cacheKey()
+	if data, found := cache.Get(lang, key, ext); found {
+		diag.explainf("using the cached result")
 		_, err := output.Write(data)
 		return err
 	}
 
-	tempDir, err := os.MkdirTemp("", "laminate-")
+	tempDir, err := os.MkdirTemp("", tempDirPrefix)
 	if err != nil {
 		return fmt.Errorf("failed to create temp directory: %w", err)
 	}
@@ -102,20 +460,56 @@ func ExecuteWithCache(ctx context.Context, config *Config, lang, input string, o
 		lang:   lang,
 		input:  input,
 		output: filepath.Join(tempDir, "output."+ext),
+		attrs:  attrs,
+		dir:    tempDir,
+
+		wrapper:   cmd.getWrapper(config),
+		timeout:   cmd.getTimeout(config),
+		maxOutput: cmd.getMaxOutputBytes(config),
+		rlimits:   cmd.getRlimits(config),
+		workers:   config.getWorkers(),
+		diag:      diag,
 	}
 	data, err := executor.Execute(ctx)
 	if err != nil {
 		return err
 	}
+	if data, err = cmd.processOutput(data, ext, opts, diag); err != nil {
+		return err
+	}
 
-	if cacheErr := cache.Set(lang, input, ext, data); cacheErr != nil {
+	warning, err := cmd.validateOutput(data, ext)
+	if err != nil {
+		return fmt.Errorf("invalid output: %w", err)
+	}
+	if warning != "" {
+		// Hand the output over, but keep questionable results out of the cache
+		diag.warn("%s", warning)
+	} else if cacheErr := cache.Set(lang, key, ext, data); cacheErr != nil {
 		// Log cache error but don't fail the operation
-		fmt.Fprintf(os.Stderr, "Warning: failed to cache result: %v\n", cacheErr)
+		diag.warn("failed to cache result: %v", cacheErr)
 	}
 	_, err = output.Write(data)
 	return err
 }
 
+// cacheInput returns the string the cache is keyed on. Attributes take part in
+// the key so that the same input rendered with another theme is not mixed up,
+// while inputs without attributes keep their original key.
+func cacheInput(input string, attrs map[string][]string) string {
+	if len(attrs) == 0 {
+		return input
+	}
+	var b strings.Builder
+	b.WriteString(input)
+	for _, k := range slices.Sorted(maps.Keys(attrs)) {
+		for _, v := range attrs[k] {
+			fmt.Fprintf(&b, "\x00%s=%s", k, v)
+		}
+	}
+	return b.String()
+}
+
 var standaloneCommandReg = regexp.MustCompile(`^[-_.+a-zA-Z0-9]+$`)
 
 func (cmd *Command) buildCommand(c string) ([]string, error) {
@@ -0,0 +1,247 @@
+package laminate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestExecutor_getArgv(t *testing.T) {
+	tests := []struct {
+		name     string
+		run      string
+		template string
+		vars     map[string]VarValue
+		attrs    map[string][]string
+		expected []string
+	}{
+		{
+			name:     "optional_flag_dropped",
+			run:      `["silicon", "{{?theme}}--theme={{theme}}", "-o", "{{output}}"]`,
+			expected: []string{"silicon", "-o", "out.png"},
+		},
+		{
+			name:     "optional_flag_from_attrs",
+			run:      `["silicon", "{{?theme}}--theme={{theme}}", "-o", "{{output}}"]`,
+			attrs:    map[string][]string{"theme": {"Nord"}},
+			expected: []string{"silicon", "--theme=Nord", "-o", "out.png"},
+		},
+		{
+			name:     "if_group_dropped",
+			run:      `["silicon", {if: theme, then: ["--theme", "{{theme}}"]}, "-l", "{{lang}}"]`,
+			expected: []string{"silicon", "-l", "go"},
+		},
+		{
+			name:     "if_group_from_vars",
+			run:      `["silicon", {if: theme, then: ["--theme", "{{theme}}"]}, "-l", "{{lang}}"]`,
+			vars:     map[string]VarValue{"theme": {"Dracula"}},
+			expected: []string{"silicon", "--theme", "Dracula", "-l", "go"},
+		},
+		{
+			name:     "attrs_override_vars",
+			run:      `["silicon", "--theme", "{{theme:-Monokai}}"]`,
+			vars:     map[string]VarValue{"theme": {"Dracula"}},
+			attrs:    map[string][]string{"theme": {"Nord"}},
+			expected: []string{"silicon", "--theme", "Nord"},
+		},
+		{
+			name:     "default_value",
+			run:      `["silicon", "--theme", "{{theme:-Monokai}}"]`,
+			expected: []string{"silicon", "--theme", "Monokai"},
+		},
+		{
+			name:     "builtin_vars_not_overridable",
+			run:      `["echo", "{{lang}}"]`,
+			attrs:    map[string][]string{"lang": {"rust"}},
+			expected: []string{"echo", "go"},
+		},
+		{
+			name:     "splat_from_vars",
+			run:      `["cc", "{{flags...}}", "{{input}}"]`,
+			vars:     map[string]VarValue{"flags": {"-O2", "-Wall"}},
+			expected: []string{"cc", "-O2", "-Wall", "in"},
+		},
+		{
+			name:     "splat_from_repeated_attrs",
+			run:      `["cc", "{{flags...}}", "{{input}}"]`,
+			vars:     map[string]VarValue{"flags": {"-O2", "-Wall"}},
+			attrs:    map[string][]string{"flags": {"-I", "include"}},
+			expected: []string{"cc", "-I", "include", "in"},
+		},
+		{
+			name:     "go_template_conditional",
+			run:      `["silicon", "{{if .theme}}--theme={{.theme}}{{end}}", "-o", "{{output}}"]`,
+			template: "go",
+			expected: []string{"silicon", "-o", "out.png"},
+		},
+		{
+			name:     "go_template_with_attrs",
+			run:      `["silicon", "{{if .theme}}--theme={{.theme}}{{end}}", "{{range list \"flags\"}}{{.}}{{end}}"]`,
+			template: "go",
+			attrs:    map[string][]string{"theme": {"Nord"}, "flags": {"-a", "-b"}},
+			expected: []string{"silicon", "--theme=Nord", "-a-b"},
+		},
+		{
+			name:     "go_template_if_group_and_splat",
+			run:      `["cc", {if: theme, then: ["{{.theme}}"]}, "{{flags...}}"]`,
+			template: "go",
+			vars:     map[string]VarValue{"flags": {"-O2", "-Wall"}},
+			expected: []string{"cc", "-O2", "-Wall"},
+		},
+		{
+			name:     "go_template_string_command",
+			run:      `'silicon {{if .theme}}--theme {{shellquote .theme}} {{end}}-o {{output}}'`,
+			template: "go",
+			attrs:    map[string][]string{"theme": {"Monokai Extended"}},
+			expected: []string{"SHELL", "-c", "silicon --theme 'Monokai Extended' -o out.png"},
+		},
+		{
+			name:     "splat_empty",
+			run:      `["cc", "{{flags...}}", "{{input}}"]`,
+			expected: []string{"cc", "in"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmd Command
+			if err := yaml.Unmarshal([]byte("run: "+tt.run), &cmd); err != nil {
+				t.Fatalf("Failed to parse run: %v", err)
+			}
+			cmd.Vars = tt.vars
+			cmd.Template = tt.template
+			cmd.Shell = "SHELL"
+			e := &Executor{cmd: &cmd, lang: "go", input: "in", output: "out.png", attrs: tt.attrs}
+			argv, err := e.getArgv()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(argv, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, argv)
+			}
+		})
+	}
+}
+
+func TestExecutor_getEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name:     "no_env",
+			expected: nil,
+		},
+		{
+			name:     "builtin_engine",
+			env:      map[string]string{"THEME": "{{theme:-Dracula}}", "LANG_NAME": "{{lang}}"},
+			expected: []string{"LANG_NAME=go", "THEME=Dracula"},
+		},
+		{
+			name:     "go_engine",
+			template: "go",
+			env:      map[string]string{"INPUT_B64": "{{base64 input}}"},
+			expected: []string{"INPUT_B64=aW4="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &Command{Env: tt.env, Template: tt.template}
+			e := &Executor{cmd: cmd, lang: "go", input: "in", output: "out.png"}
+			env, err := e.getEnv()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.expected == nil {
+				if env != nil {
+					t.Errorf("Expected nil env, got %q", env)
+				}
+				return
+			}
+			if got := env[len(env)-len(tt.expected):]; !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecutor_UnknownTemplateEngine(t *testing.T) {
+	cmd := &Command{Run: RunCommand{str: "echo"}, Template: "jinja"}
+	e := &Executor{cmd: cmd}
+	if _, err := e.getArgv(); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestExecutor_getWrappedArgv(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *Config
+		cmd      *Command
+		expected []string
+	}{
+		{
+			name:     "no_wrapper",
+			config:   &Config{},
+			cmd:      &Command{Run: RunCommand{isArray: true, array: []string{"mmdc", "-o", "{{output}}"}}},
+			expected: []string{"mmdc", "-o", "/tmp/l/output.png"},
+		},
+		{
+			name:   "config_wrapper_with_tmpdir",
+			config: &Config{Wrapper: []string{"bwrap", "--ro-bind", "/", "/", "--bind", "{{tmpdir}}", "{{tmpdir}}", "--"}},
+			cmd:    &Command{Run: RunCommand{isArray: true, array: []string{"mmdc", "-o", "{{output}}"}}},
+			expected: []string{
+				"bwrap", "--ro-bind", "/", "/", "--bind", "/tmp/l", "/tmp/l", "--",
+				"mmdc", "-o", "/tmp/l/output.png",
+			},
+		},
+		{
+			name:   "rule_wrapper_overrides",
+			config: &Config{Wrapper: []string{"firejail", "--quiet"}},
+			cmd: &Command{
+				Run:     RunCommand{str: "qrencode -o {{output}}"},
+				Shell:   "/bin/sh",
+				Wrapper: []string{"unshare", "-n", "{{?net}}--net={{net}}"},
+			},
+			expected: []string{"unshare", "-n", "/bin/sh", "-c", "qrencode -o /tmp/l/output.png"},
+		},
+		{
+			name:   "go_template_rule",
+			config: &Config{Wrapper: []string{"bwrap", "--bind", "{{tmpdir}}", "{{tmpdir}}", "--"}},
+			cmd: &Command{
+				Run:      RunCommand{isArray: true, array: []string{"mmdc", "-o", "{{.output}}"}},
+				Template: "go",
+			},
+			expected: []string{"bwrap", "--bind", "/tmp/l", "/tmp/l", "--", "mmdc", "-o", "/tmp/l/output.png"},
+		},
+		{
+			name:     "empty_rule_wrapper_disables",
+			config:   &Config{Wrapper: []string{"firejail", "--quiet"}},
+			cmd:      &Command{Run: RunCommand{str: "some-converter"}, Wrapper: []string{}},
+			expected: []string{"some-converter"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Executor{
+				cmd:     tt.cmd,
+				lang:    "go",
+				output:  "/tmp/l/output.png",
+				dir:     "/tmp/l",
+				wrapper: tt.cmd.getWrapper(tt.config),
+			}
+			argv, err := e.getWrappedArgv()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(argv, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, argv)
+			}
+		})
+	}
+}
@@ -3,8 +3,16 @@ module github.com/Songmu/laminate
 go 1.24.6
 
 require (
+	github.com/alecthomas/chroma/v2 v2.24.1
+	github.com/boombuler/barcode v1.1.0
 	github.com/gobwas/glob v0.2.3
 	github.com/goccy/go-yaml v1.18.0
 	github.com/k1LoW/exec v0.4.0
 	github.com/spf13/pathologize v0.0.0-20241128024251-dd52ec459c9d
+	golang.org/x/image v0.36.0
+)
+
+require (
+	github.com/dlclark/regexp2 v1.12.0 // indirect
+	golang.org/x/text v0.34.0 // indirect
 )
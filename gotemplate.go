@@ -0,0 +1,65 @@
+package laminate
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// expandGoTemplate renders a template with text/template. The variables are
+// available as fields of the dot ({{.theme}}) and as list values through the
+// list function ({{range list "include"}}). The built-in variables are also
+// functions, so the {{input}}, {{output}}, {{lang}}, {{format}}, {{tmpdir}}
+// and {{inputfile}} syntax keeps working.
+func expandGoTemplate(text string, vars map[string]string, lists map[string][]string) (string, error) {
+	funcs := template.FuncMap{
+		"input":     func() string { return vars["input"] },
+		"output":    func() string { return vars["output"] },
+		"lang":      func() string { return vars["lang"] },
+		"format":    func() string { return vars["format"] },
+		"tmpdir":    func() string { return vars["tmpdir"] },
+		"inputfile": func() string { return vars["inputfile"] },
+		"list": func(name string) []string {
+			return lists[name]
+		},
+		"shellquote": shellQuote,
+		"base64": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"default": func(def, value string) string {
+			if value == "" {
+				return def
+			}
+			return value
+		},
+		"join": func(sep string, values []string) string {
+			return strings.Join(values, sep)
+		},
+		"replace": func(old, new, s string) string {
+			return strings.ReplaceAll(s, old, new)
+		},
+	}
+	tmpl, err := template.New("").Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %q: %w", text, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("failed to render template %q: %w", text, err)
+	}
+	return b.String(), nil
+}
+
+// shellQuote quotes s for POSIX shells
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !strings.ContainsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=+,@%", r))
+	}) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,81 @@
+package laminate
+
+import (
+	"testing"
+)
+
+func TestExpandGoTemplate(t *testing.T) {
+	vars := map[string]string{
+		"input":   "hello world",
+		"output":  "/tmp/out.png",
+		"lang":    "go",
+		"format":  "png",
+		"tmpdir":  "/tmp",
+		"theme":   "Nord",
+		"include": "/a /b",
+	}
+	lists := map[string][]string{
+		"include": {"/a", "/b"},
+	}
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		hasError bool
+	}{
+		{"legacy_syntax", "qrencode -o {{output}} {{input}}", "qrencode -o /tmp/out.png hello world", false},
+		{"builtin_functions", "{{format}} {{tmpdir}}", "png /tmp", false},
+		{"dot_access", "--theme={{.theme}}", "--theme=Nord", false},
+		{"missing_key_is_empty", "[{{.missing}}]", "[]", false},
+		{"conditional", "{{if .theme}}--theme={{.theme}}{{end}}", "--theme=Nord", false},
+		{"conditional_missing", "{{if .missing}}--x{{end}}", "", false},
+		{"default", `{{default "Dracula" .missing}}`, "Dracula", false},
+		{"default_piped", `{{.theme | default "Dracula"}}`, "Nord", false},
+		{"shellquote", "echo {{shellquote input}}", "echo 'hello world'", false},
+		{"shellquote_single_quote", `{{shellquote "it's"}}`, `'it'\''s'`, false},
+		{"base64", "{{base64 .lang}}", "Z28=", false},
+		{"join", `{{join "," (list "include")}}`, "/a,/b", false},
+		{"range", `{{range list "include"}}-I{{.}} {{end}}`, "-I/a -I/b ", false},
+		{"replace", `{{input | replace " " "_"}}`, "hello_world", false},
+		{"parse_error", "{{if}}", "", true},
+		{"unknown_function", "{{theme}}", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := expandGoTemplate(tt.template, vars, lists)
+			if tt.hasError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "''"},
+		{"simple", "simple"},
+		{"/path/to-file.png", "/path/to-file.png"},
+		{"with space", "'with space'"},
+		{"$HOME", "'$HOME'"},
+		{"it's", `'it'\''s'`},
+	}
+
+	for _, tt := range tests {
+		if result := shellQuote(tt.input); result != tt.expected {
+			t.Errorf("shellQuote(%q): expected %s, got %s", tt.input, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package laminate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// renderImage passes through input that is already an image: a data URI,
+// base64 or inline SVG. The data is validated and returned as is, leaving
+// conversion between raster formats to the output processing.
+func renderImage(req *builtinRequest) ([]byte, error) {
+	data, err := decodeImageInput(req.input)
+	if err != nil {
+		return nil, err
+	}
+	format := detectFormat(data)
+	switch {
+	case slices.Contains(rasterFormats, format):
+		if _, _, err := decodeImage(data); err != nil {
+			return nil, err
+		}
+	case format == "svg":
+		if err := checkXML(data); err != nil {
+			return nil, fmt.Errorf("invalid svg: %w", err)
+		}
+	case format == "":
+		return nil, fmt.Errorf("unrecognized image data, want PNG, JPEG, GIF or SVG")
+	default:
+		return nil, fmt.Errorf("%s is not supported, want PNG, JPEG, GIF or SVG", format)
+	}
+	// A lang naming a format, as in ```png, must match the data
+	if lang := normalizeFormat(req.lang); lang != format && (lang == "svg" || slices.Contains(rasterFormats, lang)) {
+		return nil, fmt.Errorf("the %s block contains %s data", req.lang, format)
+	}
+	if format != req.format && (format == "svg" || req.format == "svg") {
+		return nil, fmt.Errorf("cannot convert %s to %s", format, req.format)
+	}
+	return data, nil
+}
+
+// detectImageInput returns the format of the image input, or "" when it is
+// not recognized
+func detectImageInput(input string) string {
+	data, err := decodeImageInput(input)
+	if err != nil {
+		return ""
+	}
+	return detectFormat(data)
+}
+
+// decodeImageInput returns the bytes of a data URI, inline SVG or base64
+// input. Whitespace in base64, such as line wrapping, is ignored.
+func decodeImageInput(input string) ([]byte, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, fmt.Errorf("nothing to decode")
+	}
+	if rest, ok := strings.CutPrefix(input, "data:"); ok {
+		return decodeDataURI(rest)
+	}
+	if strings.HasPrefix(input, "<") {
+		return []byte(input), nil
+	}
+	data, err := decodeBase64(input)
+	if err != nil {
+		return nil, fmt.Errorf("input is neither a data URI, SVG nor base64: %w", err)
+	}
+	return data, nil
+}
+
+// decodeDataURI decodes the part of a data URI after `data:`, which is
+// base64 or percent-encoded
+func decodeDataURI(s string) ([]byte, error) {
+	params, payload, ok := strings.Cut(s, ",")
+	if !ok {
+		return nil, fmt.Errorf("invalid data URI: missing comma")
+	}
+	if strings.HasSuffix(params, ";base64") {
+		data, err := decodeBase64(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data URI: %w", err)
+		}
+		return data, nil
+	}
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URI: %w", err)
+	}
+	return []byte(data), nil
+}
+
+// decodeBase64 decodes standard base64, padded or not, ignoring whitespace
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(s)
+	}
+	return data, err
+}
+
+// checkXML reports the first syntax error of the document
+func checkXML(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := dec.Token(); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package laminate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRenderImage(t *testing.T) {
+	pngData := encodeTestImage(t, "png")
+	b64 := base64.StdEncoding.EncodeToString(pngData)
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" width="4" height="4"><rect width="4" height="4"/></svg>`
+
+	tests := []struct {
+		name   string
+		lang   string
+		input  string
+		format string
+		want   []byte
+	}{
+		{"base64", "png", b64 + "\n", "png", pngData},
+		{"base64_wrapped", "base64", b64[:20] + "\n" + b64[20:], "png", pngData},
+		{"base64_unpadded", "base64", strings.TrimRight(b64, "="), "png", pngData},
+		{"data_uri", "datauri", "data:image/png;base64," + b64, "png", pngData},
+		{"data_uri_svg", "datauri", "data:image/svg+xml," + url.PathEscape(svg), "svg", []byte(svg)},
+		{"inline_svg", "svg", "\n" + svg + "\n", "svg", []byte(svg)},
+		// Raster formats are converted by the output processing
+		{"png_as_jpg", "png", b64, "jpg", pngData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderImage(&builtinRequest{lang: tt.lang, input: tt.input, format: tt.format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRenderImage_Errors(t *testing.T) {
+	pngData := encodeTestImage(t, "png")
+	b64 := base64.StdEncoding.EncodeToString(pngData)
+
+	tests := []struct {
+		name   string
+		lang   string
+		input  string
+		format string
+		errMsg string
+	}{
+		{"empty", "png", " \n", "png", "nothing to decode"},
+		{"not_base64", "png", "hello, world", "png", "input is neither a data URI, SVG nor base64"},
+		{"text", "base64", base64.StdEncoding.EncodeToString([]byte("hello")), "png", "unrecognized image data"},
+		{"truncated", "png", base64.StdEncoding.EncodeToString(pngData[:40]), "png", "failed to decode png"},
+		{"pdf", "base64", base64.StdEncoding.EncodeToString([]byte("%PDF-1.7\n")), "png", "pdf is not supported"},
+		{"invalid_svg", "svg", "<svg><rect></svg>", "svg", "invalid svg"},
+		{"data_uri_without_comma", "datauri", "data:image/png;base64", "png", "missing comma"},
+		{"lang_mismatch", "jpeg", b64, "jpg", "the jpeg block contains png data"},
+		{"svg_to_png", "svg", "<svg></svg>", "png", "cannot convert svg to png"},
+		{"png_to_svg", "png", b64, "svg", "cannot convert png to svg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := renderImage(&builtinRequest{lang: tt.lang, input: tt.input, format: tt.format})
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
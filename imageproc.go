@@ -0,0 +1,103 @@
+package laminate
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// rasterFormats are the formats laminate can decode and encode in-process
+var rasterFormats = []string{"png", "jpg", "gif"}
+
+// decodeImage decodes a PNG, JPEG or GIF image, returning its format. Only
+// the first frame of an animated GIF is decoded.
+func decodeImage(data []byte) (image.Image, string, error) {
+	format := detectFormat(data)
+	var (
+		img image.Image
+		err error
+	)
+	switch format {
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "jpg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	case "":
+		return nil, "", fmt.Errorf("unrecognized image data, want PNG, JPEG or GIF")
+	default:
+		return nil, "", fmt.Errorf("%s is not supported, want PNG, JPEG or GIF", format)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s: %w", format, err)
+	}
+	return img, format, nil
+}
+
+// encodeImage encodes the image in the given format. JPEG has no alpha
+// channel, so transparent images are flattened onto white first. Nil options
+// select the defaults.
+func encodeImage(img image.Image, format string, opts *encodeOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &encodeOptions{jpegQuality: defaultJPEGQuality}
+	}
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = (&png.Encoder{CompressionLevel: opts.pngCompression}).Encode(&buf, img)
+	case "jpg":
+		err = jpeg.Encode(&buf, flatten(img, hexColor(0xffffffff)), &jpeg.Options{Quality: opts.jpegQuality})
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		return nil, fmt.Errorf("cannot encode %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// toRGBA returns the image as *image.RGBA with its origin at (0, 0)
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// flatten draws the image over the background color, removing transparency.
+// Opaque images are returned as is.
+func flatten(img image.Image, bg color.Color) image.Image {
+	if isOpaque(img) {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// isOpaque reports whether the image has no transparent pixels
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
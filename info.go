@@ -0,0 +1,60 @@
+package laminate
+
+import (
+	"strings"
+)
+
+// parseInfoString splits a code block info string such as
+// `go theme=Dracula title="main.go"` into the language and its attributes.
+// Attributes may also be wrapped in braces, as in `go {theme=Dracula}`.
+// A key given several times yields a list value. Tokens without `=` are ignored.
+func parseInfoString(info string) (lang string, attrs map[string][]string) {
+	tokens := splitInfoString(info)
+	if len(tokens) == 0 {
+		return "", nil
+	}
+	lang = tokens[0]
+	for _, token := range tokens[1:] {
+		token = strings.Trim(token, "{},")
+		key, value, ok := strings.Cut(token, "=")
+		if !ok || !templateVarNameReg.MatchString(key) {
+			continue
+		}
+		if attrs == nil {
+			attrs = make(map[string][]string)
+		}
+		attrs[key] = append(attrs[key], value)
+	}
+	return lang, attrs
+}
+
+// splitInfoString splits the info string on whitespace, keeping double
+// quoted sections together and removing the quotes.
+func splitInfoString(info string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		inQuote bool
+		inToken bool
+	)
+	for _, r := range info {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			inToken = true
+		case !inQuote && (r == ' ' || r == '\t'):
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
@@ -0,0 +1,36 @@
+package laminate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseInfoString(t *testing.T) {
+	tests := []struct {
+		name  string
+		info  string
+		lang  string
+		attrs map[string][]string
+	}{
+		{"empty", "", "", nil},
+		{"lang_only", "go", "go", nil},
+		{"attributes", "go theme=Dracula font=Hack", "go", map[string][]string{"theme": {"Dracula"}, "font": {"Hack"}}},
+		{"quoted_value", `go title="main file.go"`, "go", map[string][]string{"title": {"main file.go"}}},
+		{"braces", "mermaid {theme=dark, width=800}", "mermaid", map[string][]string{"theme": {"dark"}, "width": {"800"}}},
+		{"empty_value", "go theme=", "go", map[string][]string{"theme": {""}}},
+		{"bare_tokens_ignored", "go linenos theme=Nord", "go", map[string][]string{"theme": {"Nord"}}},
+		{"repeated_key", "c include=/a include=/b", "c", map[string][]string{"include": {"/a", "/b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang, attrs := parseInfoString(tt.info)
+			if lang != tt.lang {
+				t.Errorf("Expected lang %q, got %q", tt.lang, lang)
+			}
+			if !reflect.DeepEqual(attrs, tt.attrs) {
+				t.Errorf("Expected attrs %v, got %v", tt.attrs, attrs)
+			}
+		})
+	}
+}
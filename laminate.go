@@ -1,8 +1,8 @@
 package laminate
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -14,12 +14,27 @@ const cmdName = "laminate"
 
 // Run the laminate
 func Run(ctx context.Context, argv []string, outStream, errStream io.Writer) error {
+	diag := &diagnostics{w: errStream}
+	err := run(ctx, argv, outStream, errStream, diag)
+	if err != nil && err != flag.ErrHelp && diag.json {
+		diag.reportError(err)
+		return &reportedError{err}
+	}
+	return err
+}
+
+func run(ctx context.Context, argv []string, outStream, errStream io.Writer, diag *diagnostics) error {
 	log.SetOutput(errStream)
 	fs := flag.NewFlagSet(
 		fmt.Sprintf("%s (v%s rev:%s)", cmdName, version, revision), flag.ContinueOnError)
 	fs.SetOutput(errStream)
 	ver := fs.Bool("version", false, "display version")
 	lang := fs.String("lang", "", "code language (can also be set via CODEBLOCK_LANG env var)")
+	format := fs.String("format", "", "output format such as png or svg (can also be set via CODEBLOCK_FORMAT env var)")
+	quiet := fs.Bool("quiet", false, "hide the output of successful commands")
+	explain := fs.Bool("explain", false, "explain the steps taken, such as the matched rule and each attempt")
+	diagnostics := fs.String("diagnostics", "", "diagnostics format: text or json")
+	batch := fs.Bool("batch", false, "render line-delimited JSON requests read from stdin, keeping workers alive")
 	if err := fs.Parse(argv); err != nil {
 		return err
 	}
@@ -34,23 +49,59 @@ func Run(ctx context.Context, argv []string, outStream, errStream io.Writer) err
 		codeLang = *lang
 	}
 
+	if err := diag.setFormat(*diagnostics); err != nil {
+		return err
+	}
+
 	// Load configuration
 	config, err := LoadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	if *quiet {
+		config.Quiet = true
+	}
+	if *explain {
+		config.Explain = true
+	}
+	if *diagnostics != "" {
+		config.Diagnostics = *diagnostics
+	} else if err := diag.setFormat(config.Diagnostics); err != nil {
+		return &ConfigError{Err: err}
+	}
+
+	// Get output format from flag, environment or config file, in that order
+	if f := os.Getenv("CODEBLOCK_FORMAT"); f != "" {
+		config.Format = f
+	}
+	if *format != "" {
+		config.Format = *format
+	}
+
+	// Remove temporary directories left by runs that were killed
+	sweepStaleTempDirs()
+
 	// Check if we have any commands configured
 	if len(config.Commands) == 0 {
-		return fmt.Errorf("no commands configured. Please create a config file at %s", getConfigPath())
+		return &ConfigError{Err: fmt.Errorf("no commands configured. Please create a config file at %s", getConfigPath())}
+	}
+	defer config.Close()
+
+	if *batch {
+		return runBatch(ctx, config, os.Stdin, outStream)
 	}
 
-	// Read input from stdin
-	var inputBuffer bytes.Buffer
-	if _, err := io.Copy(&inputBuffer, os.Stdin); err != nil {
+	// Read input from stdin, stopping as soon as it exceeds the limit
+	maxInput := config.getMaxInputBytes(ctx, codeLang, newDiagnostics(config))
+	b, err := readLimited(os.Stdin, maxInput)
+	if err != nil {
+		if errors.Is(err, errSizeLimit) {
+			return fmt.Errorf("input exceeds max_input_bytes (%d bytes)", maxInput)
+		}
 		return fmt.Errorf("failed to read input: %w", err)
 	}
-	input := inputBuffer.String()
+	input := string(b)
 
 	if input == "" {
 		return fmt.Errorf("no input provided")
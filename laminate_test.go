@@ -2,7 +2,15 @@ package laminate_test
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
 	"math"
 	"os"
 	"path/filepath"
@@ -38,6 +46,8 @@ func createTestConfigFromFile(t *testing.T, configPath, configType string) {
 		sourceConfig = "testdata/test_config_no_cache.yaml"
 	case "asterisk_first":
 		sourceConfig = "testdata/test_config_asterisk_first.yaml"
+	case "formats":
+		sourceConfig = "testdata/test_config_formats.yaml"
 	default:
 		t.Fatalf("Unknown config type: %s", configType)
 	}
@@ -86,6 +96,14 @@ func assertImageFormat(t *testing.T, output []byte, format string) {
 		if len(output) < 4 || output[0] != 0xFF || output[1] != 0xD8 || output[2] != 0xFF {
 			t.Errorf("Expected JPEG signature, got: %v", output[:min(4, len(output))])
 		}
+	case "gif":
+		if !bytes.HasPrefix(output, []byte("GIF8")) {
+			t.Errorf("Expected GIF signature, got: %v", output[:min(4, len(output))])
+		}
+	case "svg":
+		if !bytes.HasPrefix(output, []byte("<svg")) {
+			t.Errorf("Expected SVG, got: %q", output[:min(32, len(output))])
+		}
 	default:
 		t.Errorf("Unknown image format: %s", format)
 	}
@@ -249,6 +267,520 @@ func TestRun_ImageGeneration(t *testing.T) {
 	}
 }
 
+func TestRun_Format(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		envFormat string
+		format    string
+		errMsg    string
+	}{
+		{
+			name:   "no_format_first_match",
+			args:   []string{"--lang", "diagram"},
+			format: "png",
+		},
+		{
+			name:   "format_flag_selects_rule",
+			args:   []string{"--lang", "diagram", "--format", "jpg"},
+			format: "jpg",
+		},
+		{
+			name:      "format_env",
+			args:      []string{"--lang", "diagram"},
+			envFormat: "jpeg",
+			format:    "jpg",
+		},
+		{
+			name:      "format_flag_precedence_over_env",
+			args:      []string{"--lang", "diagram", "--format", "png"},
+			envFormat: "jpg",
+			format:    "png",
+		},
+		{
+			name:   "format_converted",
+			args:   []string{"--lang", "diagram", "--format", "gif"},
+			format: "gif",
+		},
+		{
+			name:   "format_not_supported",
+			args:   []string{"--lang", "diagram", "--format", "svg"},
+			errMsg: "no matching command found for language: diagram (format: svg)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath, _ := setupTestEnv(t)
+			createTestConfigFromFile(t, configPath, "formats")
+			t.Setenv("CODEBLOCK_FORMAT", tt.envFormat)
+
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput("format test content")
+			defer cleanupStdin()
+
+			err := laminate.Run(context.Background(), tt.args, &outBuf, &errBuf)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			assertImageFormat(t, outBuf.Bytes(), tt.format)
+		})
+	}
+}
+
+func TestRun_InvalidOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		run    string
+		errMsg string
+	}{
+		{"empty_output", "go run testdata/stub_image_generator.go -o /dev/null", "empty output"},
+		{"html_output", "echo '<html><body>Bad Gateway</body></html>'", "HTML document"},
+		{"mismatch_strict", `go run testdata/stub_image_generator.go -o "{{output}}.jpg" && mv "{{output}}.jpg" "{{output}}"`, "looks like jpg, not png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath, cachePath := setupTestEnv(t)
+			config := fmt.Sprintf("cache: 1h\ncommands:\n- lang: '*'\n  run: %q\n  validate: strict\n", tt.run)
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput("invalid output test")
+			defer cleanupStdin()
+
+			err := laminate.Run(context.Background(), []string{"--lang", "text"}, &outBuf, &errBuf)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+			}
+			if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+				t.Errorf("Expected nothing to be cached, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestRun_ConvertToExt(t *testing.T) {
+	configPath, _ := setupTestEnv(t)
+	run := `go run testdata/stub_image_generator.go -o "{{output}}.jpg" && mv "{{output}}.jpg" "{{output}}"`
+	config := fmt.Sprintf("commands:\n- lang: '*'\n  run: %q\n  validate: strict\n  convert: true\n", run)
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	cleanupStdin := setupStdinWithInput("convert test")
+	defer cleanupStdin()
+
+	if err := laminate.Run(context.Background(), []string{"--lang", "text"}, &outBuf, &errBuf); err != nil {
+		t.Fatalf("Expected the jpg output to be converted, got: %v", err)
+	}
+	assertImageFormat(t, outBuf.Bytes(), "png")
+}
+
+func TestRun_ErrorTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		lang     string
+		exitCode int
+		check    func(t *testing.T, err error)
+	}{
+		{
+			name:     "config_error",
+			config:   "commands: {lang: [}\n",
+			lang:     "go",
+			exitCode: 2,
+			check: func(t *testing.T, err error) {
+				var cerr *laminate.ConfigError
+				if !errors.As(err, &cerr) {
+					t.Errorf("Expected ConfigError, got %T", err)
+				}
+			},
+		},
+		{
+			name:     "no_match",
+			config:   "commands:\n- lang: go\n  run: 'true'\n",
+			lang:     "python",
+			exitCode: 3,
+			check: func(t *testing.T, err error) {
+				var nerr *laminate.NoMatchError
+				if !errors.As(err, &nerr) || nerr.Lang != "python" {
+					t.Errorf("Expected NoMatchError for python, got %v", err)
+				}
+			},
+		},
+		{
+			name:     "command_error",
+			config:   "commands:\n- lang: '*'\n  run: 'echo broken renderer >&2; exit 3'\n",
+			lang:     "go",
+			exitCode: 4,
+			check: func(t *testing.T, err error) {
+				var cerr *laminate.CommandError
+				if !errors.As(err, &cerr) {
+					t.Fatalf("Expected CommandError, got %T", err)
+				}
+				if cerr.Rule != "*" || cerr.ExitStatus != 3 || len(cerr.Argv) != 3 {
+					t.Errorf("Unexpected CommandError: %+v", cerr)
+				}
+				if !strings.Contains(cerr.Stderr, "broken renderer") {
+					t.Errorf("Expected stderr tail, got %q", cerr.Stderr)
+				}
+			},
+		},
+		{
+			name:     "command_not_found",
+			config:   "commands:\n- lang: '*'\n  run: ['laminate-no-such-command']\n",
+			lang:     "go",
+			exitCode: 4,
+			check: func(t *testing.T, err error) {
+				var cerr *laminate.CommandError
+				if !errors.As(err, &cerr) || cerr.ExitStatus != -1 {
+					t.Errorf("Expected CommandError without exit status, got %v", err)
+				}
+			},
+		},
+		{
+			name:     "timeout",
+			config:   "timeout: 10s\ncommands:\n- lang: '*'\n  run: 'sleep 5'\n  timeout: 100ms\n",
+			lang:     "go",
+			exitCode: 124,
+			check: func(t *testing.T, err error) {
+				var terr *laminate.TimeoutError
+				if !errors.As(err, &terr) || terr.Timeout != 100*time.Millisecond {
+					t.Errorf("Expected TimeoutError after 100ms, got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath, _ := setupTestEnv(t)
+			if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput("error test")
+			defer cleanupStdin()
+
+			err := laminate.Run(context.Background(), []string{"--lang", tt.lang}, &outBuf, &errBuf)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			tt.check(t, err)
+			var ecoder interface{ ExitCode() int }
+			if !errors.As(err, &ecoder) || ecoder.ExitCode() != tt.exitCode {
+				t.Errorf("Expected exit code %d, got %v", tt.exitCode, err)
+			}
+		})
+	}
+}
+
+func TestRun_Diagnostics(t *testing.T) {
+	const (
+		noisy  = `echo progress >&2; go run testdata/stub_image_generator.go -o "{{output}}"`
+		broken = `echo progress >&2; echo "fatal: broken" >&2; exit 2`
+	)
+	tests := []struct {
+		name  string
+		run   string
+		args  []string
+		check func(t *testing.T, err error, stderr string)
+	}{
+		{
+			name: "success_shows_command_output",
+			run:  noisy,
+			check: func(t *testing.T, err error, stderr string) {
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				if stderr != "progress\n" {
+					t.Errorf("Expected command stderr, got %q", stderr)
+				}
+			},
+		},
+		{
+			name: "success_quiet",
+			run:  noisy,
+			args: []string{"--quiet"},
+			check: func(t *testing.T, err error, stderr string) {
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				if stderr != "" {
+					t.Errorf("Expected no output, got %q", stderr)
+				}
+			},
+		},
+		{
+			name: "failure_quiet_attaches_stderr",
+			run:  broken,
+			args: []string{"--quiet"},
+			check: func(t *testing.T, err error, stderr string) {
+				if err == nil || !strings.Contains(err.Error(), "fatal: broken") {
+					t.Errorf("Expected error with stderr, got: %v", err)
+				}
+				if laminate.IsReported(err) {
+					t.Error("Expected error not to be reported in text mode")
+				}
+				if stderr != "" {
+					t.Errorf("Expected stderr only in the error, got %q", stderr)
+				}
+			},
+		},
+		{
+			name: "success_json",
+			run:  noisy,
+			args: []string{"--diagnostics", "json"},
+			check: func(t *testing.T, err error, stderr string) {
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				var record map[string]any
+				if err := json.Unmarshal([]byte(stderr), &record); err != nil {
+					t.Fatalf("Expected a JSON line, got %q", stderr)
+				}
+				if record["level"] != "info" || record["stderr"] != "progress\n" || record["rule"] != "*" {
+					t.Errorf("Unexpected record: %v", record)
+				}
+			},
+		},
+		{
+			name: "failure_json",
+			run:  broken,
+			args: []string{"--diagnostics", "json", "--quiet"},
+			check: func(t *testing.T, err error, stderr string) {
+				if !laminate.IsReported(err) {
+					t.Errorf("Expected error to be reported, got: %v", err)
+				}
+				var record map[string]any
+				if err := json.Unmarshal([]byte(stderr), &record); err != nil {
+					t.Fatalf("Expected a JSON line, got %q", stderr)
+				}
+				if record["level"] != "error" || record["exit_code"] != 4.0 || record["exit_status"] != 2.0 {
+					t.Errorf("Unexpected record: %v", record)
+				}
+				if !strings.Contains(record["stderr"].(string), "fatal: broken") {
+					t.Errorf("Expected stderr in record, got %v", record["stderr"])
+				}
+				if strings.Contains(record["message"].(string), "fatal: broken") {
+					t.Errorf("Expected stderr not to be repeated in message, got %v", record["message"])
+				}
+			},
+		},
+		{
+			name: "unknown_diagnostics_format",
+			run:  noisy,
+			args: []string{"--diagnostics", "xml"},
+			check: func(t *testing.T, err error, stderr string) {
+				if err == nil || !strings.Contains(err.Error(), "unknown diagnostics format") {
+					t.Errorf("Expected error, got: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath, _ := setupTestEnv(t)
+			config := fmt.Sprintf("commands:\n- lang: '*'\n  run: %q\n", tt.run)
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput("diagnostics test")
+			defer cleanupStdin()
+
+			err := laminate.Run(context.Background(), append([]string{"--lang", "text"}, tt.args...), &outBuf, &errBuf)
+			tt.check(t, err, errBuf.String())
+		})
+	}
+}
+
+func TestRun_Retry(t *testing.T) {
+	// Fails on the first attempt only, leaving a marker in the temporary directory
+	const flaky = `if [ -e "{{tmpdir}}/tried" ]; then go run testdata/stub_image_generator.go -o "{{output}}"; ` +
+		`else touch "{{tmpdir}}/tried"; echo "Failed to launch the browser process" >&2; exit 1; fi`
+	tests := []struct {
+		name    string
+		config  string
+		success bool
+		explain []string
+	}{
+		{
+			name:    "retried",
+			config:  "retry: {attempts: 2, backoff: 10ms, on: {stderr: 'Failed to launch'}}",
+			success: true,
+			explain: []string{"attempt 1/2: running", "attempt 1/2 failed", "retrying in 10ms", "attempt 2/2: running"},
+		},
+		{
+			name:    "condition_not_met",
+			config:  "retry: {attempts: 2, on: {exit_codes: [2]}}",
+			explain: []string{"attempt 1/2 failed"},
+		},
+		{
+			name:    "deadline",
+			config:  "timeout: 5s\n  retry: {attempts: 2, backoff: 1m}",
+			explain: []string{"not retrying: the deadline would pass during the 1m0s backoff"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath, _ := setupTestEnv(t)
+			config := fmt.Sprintf("commands:\n- lang: '*'\n  run: %q\n  %s\n", flaky, tt.config)
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput("retry test")
+			defer cleanupStdin()
+
+			err := laminate.Run(context.Background(), []string{"--lang", "mermaid", "--explain"}, &outBuf, &errBuf)
+			if tt.success {
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				assertImageFormat(t, outBuf.Bytes(), "png")
+			} else if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			for _, msg := range tt.explain {
+				if !strings.Contains(errBuf.String(), msg) {
+					t.Errorf("Expected explain output to contain %q, got:\n%s", msg, errBuf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRun_SizeLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		input  string
+		errMsg string
+	}{
+		{
+			name:   "input_within_limit",
+			config: "max_input_bytes: 16\ncommands:\n- lang: '*'\n  run: 'go run testdata/stub_image_generator.go -o \"{{output}}\"'\n",
+			input:  "0123456789abcdef",
+		},
+		{
+			name:   "input_over_config_limit",
+			config: "max_input_bytes: 16\ncommands:\n- lang: '*'\n  run: 'go run testdata/stub_image_generator.go -o \"{{output}}\"'\n",
+			input:  "0123456789abcdefg",
+			errMsg: "input exceeds max_input_bytes (16 bytes)",
+		},
+		{
+			name:   "input_rule_limit_overrides",
+			config: "max_input_bytes: 16\ncommands:\n- lang: '*'\n  run: 'go run testdata/stub_image_generator.go -o \"{{output}}\"'\n  max_input_bytes: 1KB\n",
+			input:  strings.Repeat("x", 1024),
+		},
+		{
+			name:   "stdout_over_limit",
+			config: "commands:\n- lang: '*'\n  run: 'head -c 100000 /dev/zero'\n  max_output_bytes: 1KB\n",
+			input:  "big",
+			errMsg: "output exceeds max_output_bytes (1024 bytes)",
+		},
+		{
+			name:   "file_over_limit",
+			config: "max_output_bytes: 32\ncommands:\n- lang: '*'\n  run: 'go run testdata/stub_image_generator.go -o \"{{output}}\"'\n",
+			input:  "big",
+			errMsg: "output exceeds max_output_bytes (32 bytes)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath, _ := setupTestEnv(t)
+			if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput(tt.input)
+			defer cleanupStdin()
+
+			err := laminate.Run(context.Background(), []string{"--lang", "text"}, &outBuf, &errBuf)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				assertImageFormat(t, outBuf.Bytes(), "png")
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestRun_Wrapper(t *testing.T) {
+	configPath, _ := setupTestEnv(t)
+	config := `wrapper: ['env', 'LAMINATE_SANDBOX={{tmpdir}}']
+commands:
+- lang: '*'
+  run: 'test -d "$LAMINATE_SANDBOX" && test "$LAMINATE_SANDBOX" = "{{tmpdir}}" && go run testdata/stub_image_generator.go -o "{{output}}"'
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	cleanupStdin := setupStdinWithInput("wrapper test")
+	defer cleanupStdin()
+
+	if err := laminate.Run(context.Background(), []string{"--lang", "text", "--explain"}, &outBuf, &errBuf); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	assertImageFormat(t, outBuf.Bytes(), "png")
+	if !strings.Contains(errBuf.String(), `running ["env" "LAMINATE_SANDBOX=`) {
+		t.Errorf("Expected the wrapper to prefix the command, got:\n%s", errBuf.String())
+	}
+}
+
+func TestRun_Cancel(t *testing.T) {
+	configPath, _ := setupTestEnv(t)
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	config := "commands:\n- lang: '*'\n  run: 'sleep 30'\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	cleanupStdin := setupStdinWithInput("cancel test")
+	defer cleanupStdin()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	err := laminate.Run(ctx, []string{"--lang", "text"}, &outBuf, &errBuf)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation error, got: %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Expected the command to be terminated promptly, took %v", d)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tmp, "laminate-*")); len(matches) > 0 {
+		t.Errorf("Expected temporary directories to be removed, got %v", matches)
+	}
+}
+
 func TestRun_CacheBehavior(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -328,3 +860,421 @@ func almostEqual(a, b time.Duration, relTol float64) bool {
 	bb := float64(b)
 	return math.Abs(aa-bb) <= relTol*math.Max(aa, bb)
 }
+
+func TestRun_OutputGlob(t *testing.T) {
+	stub, err := filepath.Abs("testdata/stub_image_generator.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		pick   string
+		format string
+	}{
+		{"first", "first", "png"},
+		{"last", "last", "jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath, _ := setupTestEnv(t)
+			config := fmt.Sprintf(`commands:
+- lang: multi
+  run: 'go run %[1]s -o out-10.jpg < {{inputfile}} && go run %[1]s -o out-2.png < {{inputfile}}'
+  output_glob: 'out-*'
+  output_pick: %[2]s
+`, stub, tt.pick)
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput("glob test content")
+			defer cleanupStdin()
+
+			if err := laminate.Run(context.Background(), []string{"--lang", "multi"}, &outBuf, &errBuf); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			assertImageFormat(t, outBuf.Bytes(), tt.format)
+		})
+	}
+}
+
+func TestRun_Worker(t *testing.T) {
+	configPath, _ := setupTestEnv(t)
+	config := `commands:
+- lang: diagram
+  worker:
+    command: ['go', 'run', 'testdata/stub_worker.go']
+    max_jobs: 2
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	t.Run("single", func(t *testing.T) {
+		var outBuf, errBuf bytes.Buffer
+		cleanupStdin := setupStdinWithInput("worker test")
+		defer cleanupStdin()
+
+		if err := laminate.Run(context.Background(), []string{"--lang", "diagram"}, &outBuf, &errBuf); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		assertImageFormat(t, outBuf.Bytes(), "png")
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		inputs := []string{"one", "fail", "crash", "two", "three"}
+		var requests strings.Builder
+		for i, input := range inputs {
+			fmt.Fprintf(&requests, `{"id": %d, "lang": "diagram", "input": %q}`+"\n", i, input)
+		}
+		var outBuf, errBuf bytes.Buffer
+		cleanupStdin := setupStdinWithInput(requests.String())
+		defer cleanupStdin()
+
+		if err := laminate.Run(context.Background(), []string{"--batch", "--explain"}, &outBuf, &errBuf); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		dec := json.NewDecoder(&outBuf)
+		for i, input := range inputs {
+			var res struct {
+				ID    int    `json:"id"`
+				Data  []byte `json:"data"`
+				Error string `json:"error"`
+			}
+			if err := dec.Decode(&res); err != nil {
+				t.Fatalf("Failed to decode response %d: %v", i, err)
+			}
+			if res.ID != i {
+				t.Errorf("Expected response id %d, got %d", i, res.ID)
+			}
+			switch input {
+			case "fail":
+				if !strings.Contains(res.Error, "cannot render") {
+					t.Errorf("Expected the worker's error, got: %q", res.Error)
+				}
+			case "crash":
+				if !strings.Contains(res.Error, "worker crashed") {
+					t.Errorf("Expected a crash error, got: %q", res.Error)
+				}
+			default:
+				if res.Error != "" {
+					t.Errorf("Expected no error for %q, got: %s", input, res.Error)
+				}
+				assertImageFormat(t, res.Data, "png")
+			}
+		}
+
+		// Started for "one", twice for "crash" as the retry crashes too, and
+		// for "two"; recycled after "fail" and "three"
+		explain := errBuf.String()
+		if n := strings.Count(explain, "started worker"); n != 4 {
+			t.Errorf("Expected 4 worker starts, got %d:\n%s", n, explain)
+		}
+		if n := strings.Count(explain, "recycling worker"); n != 2 {
+			t.Errorf("Expected 2 recycles, got %d:\n%s", n, explain)
+		}
+	})
+
+	t.Run("wrapper", func(t *testing.T) {
+		config := `wrapper: ['env']
+commands:
+- lang: wrapped
+  worker:
+    command: ['go', 'run', 'testdata/stub_worker.go']
+- lang: unwrapped
+  wrapper: []
+  worker:
+    command: ['go', 'run', 'testdata/stub_worker.go']
+`
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to create test config: %v", err)
+		}
+
+		var outBuf, errBuf bytes.Buffer
+		cleanupStdin := setupStdinWithInput("worker test")
+		err := laminate.Run(context.Background(), []string{"--lang", "wrapped"}, &outBuf, &errBuf)
+		cleanupStdin()
+		var cerr *laminate.ConfigError
+		if !errors.As(err, &cerr) || !strings.Contains(err.Error(), "wrapper: []") {
+			t.Errorf("Expected a ConfigError about the wrapper, got: %v", err)
+		}
+
+		outBuf.Reset()
+		cleanupStdin = setupStdinWithInput("worker test")
+		defer cleanupStdin()
+		if err := laminate.Run(context.Background(), []string{"--lang", "unwrapped"}, &outBuf, &errBuf); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		assertImageFormat(t, outBuf.Bytes(), "png")
+	})
+}
+
+func TestRun_Plugin(t *testing.T) {
+	configPath, _ := setupTestEnv(t)
+	stub, err := filepath.Abs("testdata/stub_plugin.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDir := filepath.Join(filepath.Dir(configPath), "plugins")
+	if err := os.Mkdir(pluginDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf("#!/bin/sh\nexec go run %q\n", stub)
+	for _, path := range []string{filepath.Join(pluginDir, "stub"), filepath.Join(filepath.Dir(configPath), "custom")} {
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := `commands:
+- lang: custom
+  plugin: custom
+- lang: '*'
+  run: 'go run testdata/stub_image_generator.go -o "{{output}}"'
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		input  string
+		stderr string
+		errMsg string
+	}{
+		{
+			name:   "discovered",
+			args:   []string{"--lang", "stub-x theme=dark"},
+			input:  "plugin test",
+			stderr: "stub: rendered stub-x with theme [dark]",
+		},
+		{
+			name:   "configured",
+			args:   []string{"--lang", "custom"},
+			input:  "plugin test",
+			stderr: "stub: rendered custom with theme []",
+		},
+		{
+			name:   "not_declared",
+			args:   []string{"--lang", "other", "--explain"},
+			input:  "plugin test",
+			stderr: `matched the rule "*"`,
+		},
+		{
+			name:   "render_error",
+			args:   []string{"--lang", "stub"},
+			input:  "fail",
+			errMsg: "cannot render",
+		},
+		{
+			name:   "format_not_declared",
+			args:   []string{"--lang", "stub", "--format", "svg"},
+			input:  "plugin test",
+			errMsg: "no matching command found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput(tt.input)
+			defer cleanupStdin()
+
+			err := laminate.Run(context.Background(), tt.args, &outBuf, &errBuf)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			assertImageFormat(t, outBuf.Bytes(), "png")
+			if !strings.Contains(errBuf.String(), tt.stderr) {
+				t.Errorf("Expected stderr to contain %q, got:\n%s", tt.stderr, errBuf.String())
+			}
+		})
+	}
+}
+
+func TestRun_Builtin(t *testing.T) {
+	configPath, _ := setupTestEnv(t)
+	config := `commands:
+- lang: text
+  builtin: text
+  vars:
+    font_size: '20'
+- lang: jpgtext
+  builtin: text
+  ext: jpg
+- lang: padded
+  builtin: text
+  postprocess: {padding: 2}
+- lang: qr
+  builtin: qr
+- lang: barcode
+  builtin: barcode
+- lang: chart
+  builtin: chart
+- lang: table
+  builtin: table
+- lang: '{go,python}'
+  builtin: code
+- lang: unknown
+  builtin: unknown
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		input  string
+		format string
+		errMsg string
+	}{
+		{name: "text", args: []string{"--lang", "text padding=4"}},
+		{name: "qr", args: []string{"--lang", "qr level=H"}},
+		{name: "code", args: []string{"--lang", "go theme=monokai line_numbers=true"}},
+		{name: "code_svg", args: []string{"--lang", "python", "--format", "svg"}, format: "svg"},
+		{name: "qr_svg", args: []string{"--lang", "qr", "--format", "svg"}, format: "svg"},
+		{name: "barcode", args: []string{"--lang", "barcode type=datamatrix"}},
+		{name: "barcode_invalid", args: []string{"--lang", "barcode type=ean13"}, errMsg: "ean13 must consist of digits"},
+		{name: "chart", args: []string{"--lang", `chart type=line title="Hello"`}, input: "x,y\na,1\nb,2\n"},
+		{name: "chart_svg", args: []string{"--lang", "chart", "--format", "svg"}, input: "x\ty\na\t1\n", format: "svg"},
+		{name: "table", args: []string{"--lang", "table align=center"}, input: "| a | b |\n|---|--:|\n| 1 | 2 |\n"},
+		{name: "table_svg", args: []string{"--lang", "table", "--format", "svg"}, input: "a,b\n1,2\n", format: "svg"},
+		{name: "font_attribute", args: []string{"--lang", "text font=testdata/missing.ttf"}},
+		{name: "font_size_bound", args: []string{"--lang", "text font_size=200000"}, errMsg: "font_size must be a positive number up to 512"},
+		{name: "ext_jpg", args: []string{"--lang", "jpgtext"}, format: "jpg"},
+		{name: "postprocess_svg", args: []string{"--lang", "padded", "--format", "svg"}, format: "svg"},
+		{name: "converted_format", args: []string{"--lang", "text", "--format", "gif"}, format: "gif"},
+		{name: "unsupported_format", args: []string{"--lang", "text", "--format", "pdf"}, errMsg: "no matching command found"},
+		{name: "unknown", args: []string{"--lang", "unknown"}, errMsg: `unknown builtin "unknown"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput(cmp.Or(tt.input, "Hello, World!\n"))
+			defer cleanupStdin()
+
+			err := laminate.Run(context.Background(), tt.args, &outBuf, &errBuf)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			assertImageFormat(t, outBuf.Bytes(), cmp.Or(tt.format, "png"))
+		})
+	}
+}
+
+func TestRun_BuiltinImage(t *testing.T) {
+	configPath, _ := setupTestEnv(t)
+	config := `commands:
+- lang: png
+  builtin: image
+- lang: datauri
+  builtin: image
+  postprocess: {padding: 2}
+- lang: svg
+  builtin: image
+  ext: svg
+- lang: '{gif,inline}'
+  builtin: image
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.StdEncoding.EncodeToString(buf.Bytes())
+	buf.Reset()
+	if err := gif.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	gif64 := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	tests := []struct {
+		name   string
+		args   []string
+		input  string
+		format string
+		errMsg string
+	}{
+		{name: "base64", args: []string{"--lang", "png"}, input: b64, format: "png"},
+		{name: "converted", args: []string{"--lang", "png", "--format", "jpg"}, input: b64, format: "jpg"},
+		{name: "data_uri", args: []string{"--lang", "datauri"}, input: "data:image/png;base64," + b64, format: "png"},
+		{name: "svg", args: []string{"--lang", "svg"}, input: `<svg xmlns="http://www.w3.org/2000/svg"></svg>`, format: "svg"},
+		{name: "gif_kept", args: []string{"--lang", "gif"}, input: gif64, format: "gif"},
+		{name: "gif_converted", args: []string{"--lang", "gif", "--format", "png"}, input: gif64, format: "png"},
+		{name: "svg_data_uri", args: []string{"--lang", "inline"}, input: "data:image/svg+xml,%3Csvg%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%3E%3C%2Fsvg%3E", format: "svg"},
+		{name: "invalid", args: []string{"--lang", "png"}, input: "not an image!", errMsg: "input is neither a data URI, SVG nor base64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var outBuf, errBuf bytes.Buffer
+			cleanupStdin := setupStdinWithInput(tt.input)
+			defer cleanupStdin()
+
+			err := laminate.Run(context.Background(), tt.args, &outBuf, &errBuf)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			assertImageFormat(t, outBuf.Bytes(), tt.format)
+			if tt.name == "data_uri" {
+				img, err := png.Decode(&outBuf)
+				if err != nil {
+					t.Fatalf("Failed to decode output: %v", err)
+				}
+				if img.Bounds().Dx() != 8 {
+					t.Errorf("Expected the padded width 8, got %d", img.Bounds().Dx())
+				}
+			}
+		})
+	}
+}
+
+func TestRun_Postprocess(t *testing.T) {
+	configPath, _ := setupTestEnv(t)
+	for _, width := range []int{20, 30} {
+		config := fmt.Sprintf("cache: 1h\ncommands:\n- lang: '*'\n  builtin: text\n  postprocess: {max_width: %d, border: 1}\n", width)
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to create test config: %v", err)
+		}
+
+		var outBuf, errBuf bytes.Buffer
+		cleanupStdin := setupStdinWithInput("postprocess test")
+		err := laminate.Run(context.Background(), []string{"--lang", "text"}, &outBuf, &errBuf)
+		cleanupStdin()
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		img, err := png.Decode(&outBuf)
+		if err != nil {
+			t.Fatalf("Failed to decode output: %v", err)
+		}
+		// The settings are part of the cache key, so the cached image of the
+		// first run is not returned for the second
+		if got := img.Bounds().Dx(); got != width+2 {
+			t.Errorf("Expected width %d, got %d", width+2, got)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package laminate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a size in bytes, written in YAML as an integer or with a unit
+// such as 512KB or 10MB (units are powers of 1024)
+type ByteSize int64
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (b *ByteSize) UnmarshalYAML(unmarshal func(any) error) error {
+	var n int64
+	if err := unmarshal(&n); err == nil {
+		*b = ByteSize(n)
+		return nil
+	}
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return fmt.Errorf("size must be an integer or a string such as 10MB")
+	}
+	size, err := parseByteSize(str)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+func parseByteSize(str string) (ByteSize, error) {
+	s := strings.ToUpper(strings.TrimSpace(str))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mul := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			mul = 1 << 10
+		case 'M':
+			mul = 1 << 20
+		case 'G':
+			mul = 1 << 30
+		}
+		if mul > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", str)
+	}
+	return ByteSize(n * mul), nil
+}
+
+// Rlimits are resource limits applied to the command's process (Linux only)
+type Rlimits struct {
+	CPUSeconds   int      `yaml:"cpu_seconds"`
+	AddressSpace ByteSize `yaml:"address_space"`
+	OpenFiles    int      `yaml:"open_files"`
+}
+
+func (r *Rlimits) isZero() bool {
+	return r == nil || (r.CPUSeconds == 0 && r.AddressSpace == 0 && r.OpenFiles == 0)
+}
+
+// getRlimits returns the rlimits for the command: each limit set on the
+// command overrides the config-level one
+func (cmd *Command) getRlimits(config *Config) *Rlimits {
+	var r Rlimits
+	for _, l := range []*Rlimits{config.Rlimits, cmd.Rlimits} {
+		if l == nil {
+			continue
+		}
+		if l.CPUSeconds > 0 {
+			r.CPUSeconds = l.CPUSeconds
+		}
+		if l.AddressSpace > 0 {
+			r.AddressSpace = l.AddressSpace
+		}
+		if l.OpenFiles > 0 {
+			r.OpenFiles = l.OpenFiles
+		}
+	}
+	return &r
+}
+
+// getMaxInputBytes returns the input size limit for the command, which
+// overrides the config-level one. Zero means no limit.
+func (cmd *Command) getMaxInputBytes(config *Config) ByteSize {
+	if cmd.MaxInputBytes > 0 {
+		return cmd.MaxInputBytes
+	}
+	return config.MaxInputBytes
+}
+
+// getMaxOutputBytes returns the output size limit for the command, which
+// overrides the config-level one. Zero means no limit.
+func (cmd *Command) getMaxOutputBytes(config *Config) ByteSize {
+	if cmd.MaxOutputBytes > 0 {
+		return cmd.MaxOutputBytes
+	}
+	return config.MaxOutputBytes
+}
+
+// getMaxInputBytes returns the input size limit for the command matching
+// the info string, as ExecuteWithCache matches it, falling back to the
+// config-level one
+func (config *Config) getMaxInputBytes(ctx context.Context, info string, diag *diagnostics) ByteSize {
+	lang, _ := parseInfoString(info)
+	if cmd, err := config.findCommand(ctx, lang, diag); err == nil {
+		return cmd.getMaxInputBytes(config)
+	}
+	return config.MaxInputBytes
+}
+
+var errSizeLimit = errors.New("size limit exceeded")
+
+// readLimited reads r up to limit bytes, failing as soon as more arrive.
+// A limit of zero means no limit.
+func readLimited(r io.Reader, limit ByteSize) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	b, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > int64(limit) {
+		return nil, errSizeLimit
+	}
+	return b, nil
+}
+
+// limitedBuffer is an io.Writer that fails once more than limit bytes have
+// been written to it. A limit of zero means no limit.
+type limitedBuffer struct {
+	limit    ByteSize
+	buf      []byte
+	exceeded bool
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if l.limit > 0 && int64(len(l.buf)+len(p)) > int64(l.limit) {
+		l.exceeded = true
+		return 0, errSizeLimit
+	}
+	l.buf = append(l.buf, p...)
+	return len(p), nil
+}
+
+func (l *limitedBuffer) Bytes() []byte {
+	return l.buf
+}
+
+func (l *limitedBuffer) String() string {
+	return string(l.buf)
+}
@@ -0,0 +1,142 @@
+package laminate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ByteSize
+		hasError bool
+	}{
+		{"1024", 1024, false},
+		{"512B", 512, false},
+		{"10K", 10 << 10, false},
+		{"10KB", 10 << 10, false},
+		{"10 MiB", 10 << 20, false},
+		{"2mb", 2 << 20, false},
+		{"1G", 1 << 30, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"-1", 0, true},
+		{"ten", 0, true},
+	}
+
+	for _, tt := range tests {
+		result, err := parseByteSize(tt.input)
+		if tt.hasError {
+			if err == nil {
+				t.Errorf("parseByteSize(%q): expected error, got %d", tt.input, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseByteSize(%q): unexpected error: %v", tt.input, err)
+		}
+		if result != tt.expected {
+			t.Errorf("parseByteSize(%q): expected %d, got %d", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestByteSize_UnmarshalYAML(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte("max_input_bytes: 4096\nmax_output_bytes: 10MB\nrlimits: {cpu_seconds: 30, address_space: 2G, open_files: 64}\n"), &config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.MaxInputBytes != 4096 || config.MaxOutputBytes != 10<<20 {
+		t.Errorf("Unexpected sizes: %d, %d", config.MaxInputBytes, config.MaxOutputBytes)
+	}
+	if config.Rlimits.CPUSeconds != 30 || config.Rlimits.AddressSpace != 2<<30 || config.Rlimits.OpenFiles != 64 {
+		t.Errorf("Unexpected rlimits: %+v", config.Rlimits)
+	}
+}
+
+func TestCommand_Limits(t *testing.T) {
+	config := &Config{
+		MaxInputBytes:  100,
+		MaxOutputBytes: 200,
+		Rlimits:        &Rlimits{CPUSeconds: 10, OpenFiles: 64},
+		Commands: []*Command{
+			{Lang: "big", MaxInputBytes: 1000, Rlimits: &Rlimits{CPUSeconds: 60, AddressSpace: 1 << 30}},
+			{Lang: "*"},
+		},
+	}
+	big, def := config.Commands[0], config.Commands[1]
+
+	if got := big.getMaxInputBytes(config); got != 1000 {
+		t.Errorf("Expected rule-level input limit, got %d", got)
+	}
+	if got := def.getMaxInputBytes(config); got != 100 {
+		t.Errorf("Expected config-level input limit, got %d", got)
+	}
+	if got := big.getMaxOutputBytes(config); got != 200 {
+		t.Errorf("Expected config-level output limit, got %d", got)
+	}
+	if got := config.getMaxInputBytes(context.Background(), "big theme=x", nil); got != 1000 {
+		t.Errorf("Expected input limit of the matching rule, got %d", got)
+	}
+	expected := Rlimits{CPUSeconds: 60, AddressSpace: 1 << 30, OpenFiles: 64}
+	if got := big.getRlimits(config); *got != expected {
+		t.Errorf("Expected merged rlimits %+v, got %+v", expected, *got)
+	}
+	if !def.getRlimits(&Config{}).isZero() {
+		t.Error("Expected no rlimits")
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	if b, err := readLimited(strings.NewReader("12345"), 5); err != nil || string(b) != "12345" {
+		t.Errorf("Expected input within the limit, got %q, %v", b, err)
+	}
+	if _, err := readLimited(strings.NewReader("123456"), 5); !errors.Is(err, errSizeLimit) {
+		t.Errorf("Expected size limit error, got %v", err)
+	}
+	if b, err := readLimited(strings.NewReader("123456"), 0); err != nil || len(b) != 6 {
+		t.Errorf("Expected no limit, got %q, %v", b, err)
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	buf := &limitedBuffer{limit: 4}
+	if _, err := buf.Write([]byte("abc")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := buf.Write([]byte("de")); !errors.Is(err, errSizeLimit) || !buf.exceeded {
+		t.Errorf("Expected size limit error, got %v", err)
+	}
+	if buf.String() != "abc" {
+		t.Errorf("Expected %q, got %q", "abc", buf.String())
+	}
+}
+
+func TestConfig_getMaxInputBytes_Plugin(t *testing.T) {
+	t.Setenv("LAMINATE_CACHE_PATH", t.TempDir())
+	plugin := filepath.Join(t.TempDir(), "stub")
+	if err := os.WriteFile(plugin, []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res := &pluginHandshake{Protocol: pluginProtocolVersion, Langs: []string{"stub"}, Formats: []string{"png"}}
+	if err := savePluginInfo(plugin, res); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{
+		MaxInputBytes: 100,
+		Commands:      []*Command{{Plugin: plugin, MaxInputBytes: 1000}, {Lang: "*"}},
+	}
+	defer config.Close()
+
+	// The plugin rule matches by its declared langs only
+	if got := config.getMaxInputBytes(context.Background(), "stub", nil); got != 1000 {
+		t.Errorf("Expected input limit of the plugin rule, got %d", got)
+	}
+}
@@ -8,16 +8,41 @@ import (
 
 // FindMatchingCommand finds the first command that matches the given language
 func FindMatchingCommand(commands []*Command, lang string) (*Command, error) {
+	return FindCommand(commands, lang, "")
+}
+
+// FindCommand finds the first command that matches the given language and
+// supports the given output format. An empty format matches any command.
+func FindCommand(commands []*Command, lang, format string) (*Command, error) {
 	for _, cmd := range commands {
-		matched, err := matchLanguage(cmd.Lang, lang)
+		matched, err := cmd.matchLang(lang)
 		if err != nil {
-			return nil, fmt.Errorf("failed to match language pattern %q: %w", cmd.Lang, err)
+			return nil, err
 		}
-		if matched {
+		if matched && cmd.SupportsFormat(format) {
 			return cmd, nil
 		}
 	}
-	return nil, fmt.Errorf("no matching command found for language: %s", lang)
+	return nil, &NoMatchError{Lang: lang, Format: format}
+}
+
+// matchLang checks if a language matches the command's lang pattern, or for
+// a plugin without a lang, one of the patterns the plugin declared
+func (cmd *Command) matchLang(lang string) (bool, error) {
+	patterns := []string{cmd.Lang}
+	if cmd.Plugin != "" && cmd.Lang == "" {
+		patterns = cmd.pluginLangs
+	}
+	for _, pattern := range patterns {
+		matched, err := matchLanguage(pattern, lang)
+		if err != nil {
+			return false, &ConfigError{Err: fmt.Errorf("failed to match language pattern %q: %w", pattern, err)}
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // matchLanguage checks if a language matches a pattern
@@ -84,3 +84,46 @@ func TestFindMatchingCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestFindCommand_Format(t *testing.T) {
+	commands := []*Command{
+		{Lang: "mermaid", Run: RunCommand{str: "cmd1"}},
+		{Lang: "mermaid", Run: RunCommand{str: "cmd2"}, Formats: []string{"svg", "pdf"}},
+		{Lang: "mermaid", Run: RunCommand{str: "cmd3"}, Ext: "jpg"},
+		{Lang: "*", Run: RunCommand{str: "cmd4"}, Ext: "svg"},
+	}
+
+	tests := []struct {
+		name        string
+		lang        string
+		format      string
+		expectedCmd string
+		hasError    bool
+	}{
+		{"no_format", "mermaid", "", "cmd1", false},
+		{"default_ext", "mermaid", "png", "cmd1", false},
+		{"formats_list", "mermaid", "svg", "cmd2", false},
+		{"formats_list_case_insensitive", "mermaid", "PDF", "cmd2", false},
+		{"ext_aware", "mermaid", "jpeg", "cmd3", false},
+		{"fallback_wildcard", "plantuml", "svg", "cmd4", false},
+		{"no_rule_for_format", "mermaid", "gif", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := FindCommand(commands, tt.lang, tt.format)
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("Expected error, got %s", cmd.Run.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cmd.Run.String() != tt.expectedCmd {
+				t.Errorf("Expected command %s, got %s", tt.expectedCmd, cmd.Run.String())
+			}
+		})
+	}
+}
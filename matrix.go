@@ -0,0 +1,126 @@
+package laminate
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/boombuler/barcode"
+)
+
+// moduleMatrix is a grid of dark and light modules, as in QR codes or, with
+// a single row, linear barcodes
+type moduleMatrix struct {
+	width, height int
+	dark          []bool
+}
+
+// matrixStyle is how a module matrix is drawn
+type matrixStyle struct {
+	moduleWidth  int // pixels
+	moduleHeight int // pixels
+	quietX       int // modules of margin on the left and right
+	quietY       int // modules of margin at the top and bottom
+	fg, bg       rgba
+}
+
+// setColors sets the colors from the foreground and background vars
+func (style *matrixStyle) setColors(req *builtinRequest) error {
+	var err error
+	if style.fg, err = req.color("foreground", "#000000"); err != nil {
+		return err
+	}
+	style.bg, err = req.color("background", "#ffffff")
+	return err
+}
+
+// newModuleMatrix reads the modules of a barcode rendered by
+// github.com/boombuler/barcode at its natural size
+func newModuleMatrix(bc barcode.Barcode) *moduleMatrix {
+	b := bc.Bounds()
+	m := &moduleMatrix{width: b.Dx(), height: b.Dy(), dark: make([]bool, b.Dx()*b.Dy())}
+	for y := range m.height {
+		for x := range m.width {
+			g := color.Gray16Model.Convert(bc.At(b.Min.X+x, b.Min.Y+y)).(color.Gray16)
+			m.dark[y*m.width+x] = g.Y < 0x8000
+		}
+	}
+	return m
+}
+
+func (m *moduleMatrix) isDark(x, y int) bool {
+	return m.dark[y*m.width+x]
+}
+
+// render draws the matrix in the given format, png or svg
+func (m *moduleMatrix) render(format string, style *matrixStyle) ([]byte, error) {
+	if err := checkImageSize(m.size(style)); err != nil {
+		return nil, err
+	}
+	switch format {
+	case "png":
+		return encodePNG(m.image(style))
+	case "svg":
+		return m.svg(style), nil
+	}
+	return nil, fmt.Errorf("unsupported format %s", format)
+}
+
+// size returns the size of the drawing in pixels
+func (m *moduleMatrix) size(style *matrixStyle) (width, height int) {
+	return (m.width + 2*style.quietX) * style.moduleWidth, (m.height + 2*style.quietY) * style.moduleHeight
+}
+
+// image draws the matrix on a two-color paletted image
+func (m *moduleMatrix) image(style *matrixStyle) image.Image {
+	width, height := m.size(style)
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{style.bg, style.fg})
+	for y := range m.height {
+		for x := range m.width {
+			if !m.isDark(x, y) {
+				continue
+			}
+			x0 := (x + style.quietX) * style.moduleWidth
+			y0 := (y + style.quietY) * style.moduleHeight
+			for py := y0; py < y0+style.moduleHeight; py++ {
+				for px := x0; px < x0+style.moduleWidth; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// svg draws the matrix as a single path, merging horizontal runs of dark
+// modules
+func (m *moduleMatrix) svg(style *matrixStyle) []byte {
+	width, height := m.size(style)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		width, height, width, height)
+	b.WriteString("\n")
+	if style.bg.A != 0 {
+		fmt.Fprintf(&b, `<rect width="%d" height="%d" %s/>`+"\n", width, height, svgFill(style.bg))
+	}
+	fmt.Fprintf(&b, `<path %s d="`, svgFill(style.fg))
+	for y := range m.height {
+		for x := 0; x < m.width; {
+			if !m.isDark(x, y) {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < m.width && m.isDark(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv%dh-%dz",
+				(x+style.quietX)*style.moduleWidth, (y+style.quietY)*style.moduleHeight,
+				run*style.moduleWidth, style.moduleHeight, run*style.moduleWidth)
+			x += run
+		}
+	}
+	b.WriteString(`"/>` + "\n</svg>\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,81 @@
+package laminate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// globOutput returns the path of the file produced by the command that
+// matches the rule's output_glob in dir. Matches are ordered naturally, so
+// that out-2.png comes before out-10.png, and output_pick selects the first
+// (default) or the last one.
+func (cmd *Command) globOutput(dir string, exclude ...string) (string, error) {
+	pattern := cmd.OutputGlob
+	if filepath.IsAbs(pattern) || slices.Contains(strings.Split(filepath.ToSlash(pattern), "/"), "..") {
+		return "", &ConfigError{Err: fmt.Errorf("output_glob must be relative to the temporary directory: %q", pattern)}
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return "", &ConfigError{Err: fmt.Errorf("invalid output_glob %q: %w", pattern, err)}
+	}
+	var files []string
+	for _, m := range matches {
+		if slices.Contains(exclude, m) {
+			continue
+		}
+		if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() {
+			files = append(files, m)
+		}
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no output file matched output_glob %q", pattern)
+	}
+	slices.SortFunc(files, naturalCompare)
+
+	switch cmd.OutputPick {
+	case "", "first":
+		return files[0], nil
+	case "last":
+		return files[len(files)-1], nil
+	}
+	return "", &ConfigError{Err: fmt.Errorf("unknown output_pick: %q", cmd.OutputPick)}
+}
+
+// naturalCompare compares strings treating runs of digits as numbers
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, ra := splitDigits(a)
+			nb, rb := splitDigits(b)
+			ta, tb := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if c := len(ta) - len(tb); c != 0 {
+				return c
+			}
+			if c := strings.Compare(ta, tb); c != 0 {
+				return c
+			}
+			a, b = ra, rb
+			continue
+		}
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func splitDigits(s string) (digits, rest string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
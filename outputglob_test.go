@@ -0,0 +1,65 @@
+package laminate
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	files := []string{"out-10.png", "out-2.png", "out-1.png", "out-01a.png", "a.png", "out-.png"}
+	slices.SortFunc(files, naturalCompare)
+	expected := []string{"a.png", "out-.png", "out-1.png", "out-01a.png", "out-2.png", "out-10.png"}
+	if !slices.Equal(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
+
+func TestCommand_globOutput(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"input.txt", "out-10.png", "out-2.png", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub.png"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		glob     string
+		pick     string
+		expected string
+		hasError bool
+	}{
+		{"first_by_default", "*.png", "", "out-2.png", false},
+		{"first", "out-*", "first", "out-2.png", false},
+		{"last", "*.png", "last", "out-10.png", false},
+		{"input_file_excluded", "*.txt", "", "notes.txt", false},
+		{"no_match", "*.svg", "", "", true},
+		{"unknown_pick", "*.png", "largest", "", true},
+		{"parent_directory", "../*.png", "", "", true},
+		{"absolute", "/tmp/*.png", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &Command{OutputGlob: tt.glob, OutputPick: tt.pick}
+			path, err := cmd.globOutput(dir, filepath.Join(dir, "input.txt"))
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("Expected error, got %s", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := filepath.Base(path); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
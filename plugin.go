@@ -0,0 +1,263 @@
+package laminate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pluginProtocolVersion is the version of the plugin protocol laminate speaks
+const pluginProtocolVersion = 1
+
+// pluginHandshake is a plugin's reply to the handshake
+type pluginHandshake struct {
+	Protocol int      `json:"protocol"`
+	Name     string   `json:"name"`
+	Langs    []string `json:"langs"`
+	Formats  []string `json:"formats"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// pluginContentTypes maps the content types plugins report to formats
+var pluginContentTypes = map[string]string{
+	"image/png":       "png",
+	"image/jpeg":      "jpg",
+	"image/gif":       "gif",
+	"image/webp":      "webp",
+	"image/bmp":       "bmp",
+	"image/svg+xml":   "svg",
+	"application/pdf": "pdf",
+	"text/html":       "html",
+}
+
+// handshake asks the plugin for the protocol version, langs and formats it
+// supports, and applies them to the rule
+func (w *worker) handshake(ctx context.Context, cmd *Command) (*pluginHandshake, error) {
+	var res pluginHandshake
+	req := &workerRequest{Type: "handshake", Protocol: pluginProtocolVersion}
+	if err := w.exchange(ctx, req, &res); err != nil {
+		return nil, fmt.Errorf("handshake failed: %w", err)
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("handshake failed: %s", res.Error)
+	}
+	if res.Protocol != pluginProtocolVersion {
+		return nil, fmt.Errorf("unsupported plugin protocol version %d, want %d", res.Protocol, pluginProtocolVersion)
+	}
+	cmd.applyHandshake(&res)
+	return &res, nil
+}
+
+// applyHandshake sets the plugin's declared name, langs and formats. The
+// rule's own lang, formats and ext take precedence over the declared ones.
+func (cmd *Command) applyHandshake(res *pluginHandshake) {
+	cmd.pluginName = res.Name
+	cmd.pluginLangs = res.Langs
+	if len(cmd.Formats) == 0 {
+		cmd.Formats = res.Formats
+	}
+	if cmd.Ext == "" && len(res.Formats) > 0 {
+		cmd.Ext = res.Formats[0]
+	}
+	cmd.handshaken = true
+}
+
+// pluginInfo is a handshake remembered across runs, which holds while the
+// plugin file keeps its size and modification time
+type pluginInfo struct {
+	Size      int64           `json:"size"`
+	ModTime   time.Time       `json:"mod_time"`
+	Handshake pluginHandshake `json:"handshake"`
+}
+
+// getPluginInfoPath returns the file handshakes are remembered in
+func getPluginInfoPath() string {
+	return filepath.Join(getCachePath(), "plugins.json")
+}
+
+func readPluginInfos() map[string]pluginInfo {
+	infos := map[string]pluginInfo{}
+	if b, err := os.ReadFile(getPluginInfoPath()); err == nil {
+		json.Unmarshal(b, &infos)
+	}
+	return infos
+}
+
+// loadPluginInfo returns the remembered handshake of the plugin, unless the
+// plugin has changed since
+func loadPluginInfo(path string) (*pluginHandshake, bool) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	info, ok := readPluginInfos()[path]
+	if !ok || info.Size != stat.Size() || !info.ModTime.Equal(stat.ModTime()) {
+		return nil, false
+	}
+	return &info.Handshake, true
+}
+
+// savePluginInfo remembers the handshake of the plugin. The file is replaced
+// by a rename, so that concurrent runs never read a partial one.
+func savePluginInfo(path string, res *pluginHandshake) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	infos := readPluginInfos()
+	infos[path] = pluginInfo{Size: stat.Size(), ModTime: stat.ModTime(), Handshake: *res}
+	b, err := json.Marshal(infos)
+	if err != nil {
+		return err
+	}
+	infoPath := getPluginInfoPath()
+	if err := os.MkdirAll(filepath.Dir(infoPath), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(infoPath), "plugins-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), infoPath)
+}
+
+// checkContentType checks the content type a plugin reported, when it is a
+// known one, against the requested format
+func checkContentType(contentType, ext string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	format, ok := pluginContentTypes[strings.TrimSpace(strings.ToLower(mediaType))]
+	if !ok || sameFormat(format, ext) {
+		return nil
+	}
+	return fmt.Errorf("plugin returned %s for format %s", contentType, ext)
+}
+
+// getPluginDir returns the directory plugins are discovered in: plugins/
+// next to the config file
+func getPluginDir() string {
+	return filepath.Join(filepath.Dir(getConfigPath()), "plugins")
+}
+
+// discoverPlugins returns rules for the executables in dir, in name order,
+// skipping those already configured. A missing dir yields no rules.
+func discoverPlugins(dir string, configured []*Command) ([]*Command, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var rules []*Command
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || !isExecutable(info) {
+			continue
+		}
+		if slices.ContainsFunc(configured, func(cmd *Command) bool { return cmd.Plugin == path }) {
+			continue
+		}
+		// A discovered plugin has no rule to opt out of the config-level
+		// wrapper in, and workers cannot be wrapped
+		rules = append(rules, &Command{Plugin: path, Wrapper: []string{}})
+	}
+	return rules, nil
+}
+
+func isExecutable(info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(info.Name()), ".exe")
+	}
+	return info.Mode().Perm()&0111 != 0
+}
+
+// addPlugins resolves the configured plugin paths relative to the config
+// file, and adds the discovered plugins before the first catch-all rule, so
+// that a `*` fallback does not shadow them
+func (config *Config) addPlugins(configDir, pluginDir string) error {
+	for _, cmd := range config.Commands {
+		if cmd.Plugin != "" && !filepath.IsAbs(cmd.Plugin) {
+			cmd.Plugin = filepath.Join(configDir, cmd.Plugin)
+		}
+	}
+	plugins, err := discoverPlugins(pluginDir, config.Commands)
+	if err != nil {
+		return fmt.Errorf("failed to discover plugins: %w", err)
+	}
+	i := slices.IndexFunc(config.Commands, func(cmd *Command) bool { return cmd.Lang == "*" })
+	if i < 0 {
+		i = len(config.Commands)
+	}
+	config.Commands = slices.Insert(config.Commands, i, plugins...)
+	return nil
+}
+
+// findCommand is FindCommand, except that plugins reached are asked for the
+// langs and formats they declare. Remembered handshakes are used when the
+// plugin is unchanged, so that matching starts no process; otherwise the
+// plugin is started. A plugin failing the handshake, or needing one while a
+// wrapper is set for it, is skipped with a warning.
+func (config *Config) findCommand(ctx context.Context, lang string, diag *diagnostics) (*Command, error) {
+	for _, cmd := range config.Commands {
+		if cmd.Plugin != "" && !cmd.handshaken {
+			if res, ok := loadPluginInfo(cmd.Plugin); ok {
+				diag.explainf("using the remembered handshake of plugin %s", cmd.Plugin)
+				cmd.applyHandshake(res)
+			}
+		}
+		if cmd.Plugin != "" && !cmd.handshaken {
+			if err := cmd.checkWorkerWrapper(cmd.getWrapper(config)); err != nil {
+				// The plugin is not started. A rule selected by its own lang
+				// reports why; one needing the declared langs is skipped.
+				if cmd.Lang == "" {
+					diag.warn("skipping plugin %s: %v", cmd.Plugin, err)
+					cmd.handshaken = true
+					continue
+				}
+				matched, merr := cmd.matchLang(lang)
+				if merr != nil {
+					return nil, merr
+				}
+				if matched {
+					return nil, err
+				}
+				continue
+			}
+			err := config.getWorkers().handshake(ctx, cmd, cmd.getRlimits(config), diag)
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			if err != nil {
+				diag.warn("skipping plugin %s: %v", cmd.Plugin, err)
+				cmd.handshaken = true
+				continue
+			}
+		}
+		matched, err := cmd.matchLang(lang)
+		if err != nil {
+			return nil, err
+		}
+		if matched && cmd.SupportsFormat(config.Format) {
+			return cmd, nil
+		}
+	}
+	return nil, &NoMatchError{Lang: lang, Format: config.Format}
+}
@@ -0,0 +1,185 @@
+package laminate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_addPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are discovered by the executable bit")
+	}
+	configDir := t.TempDir()
+	pluginDir := filepath.Join(configDir, "plugins")
+	if err := os.Mkdir(pluginDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, perm := range map[string]os.FileMode{"b": 0755, "a": 0755, "configured": 0755, "README": 0644} {
+		if err := os.WriteFile(filepath.Join(pluginDir, name), nil, perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(pluginDir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{Commands: []*Command{
+		{Lang: "qr"},
+		{Lang: "custom", Plugin: "plugins/configured"},
+		{Lang: "*"},
+		{Lang: "go"},
+	}}
+	if err := config.addPlugins(configDir, pluginDir); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"qr", "custom:configured", ":a", ":b", "*", "go"}
+	var got []string
+	for _, cmd := range config.Commands {
+		name := cmd.Lang
+		if cmd.Plugin != "" {
+			name += ":" + filepath.Base(cmd.Plugin)
+			if cmd.Lang == "" && (cmd.Wrapper == nil || len(cmd.Wrapper) != 0) {
+				t.Errorf("Expected the discovered %q to opt out of the wrapper, got %q", cmd.Plugin, cmd.Wrapper)
+			}
+			if filepath.Dir(cmd.Plugin) != pluginDir {
+				t.Errorf("Expected %q to be resolved into %s", cmd.Plugin, pluginDir)
+			}
+		}
+		got = append(got, name)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected rules %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected rules %v, got %v", want, got)
+			break
+		}
+	}
+}
+
+func TestConfig_addPlugins_NoDir(t *testing.T) {
+	config := &Config{Commands: []*Command{{Lang: "*"}}}
+	if err := config.addPlugins(t.TempDir(), filepath.Join(t.TempDir(), "plugins")); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Commands) != 1 {
+		t.Errorf("Expected no plugins, got %d rules", len(config.Commands))
+	}
+}
+
+func TestCommand_matchLang_Plugin(t *testing.T) {
+	cmd := &Command{Plugin: "/plugins/stub", pluginLangs: []string{"stub", "stub-*"}}
+	for lang, want := range map[string]bool{"stub": true, "stub-x": true, "other": false} {
+		got, err := cmd.matchLang(lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("matchLang(%q) = %v, want %v", lang, got, want)
+		}
+	}
+	// An explicit lang restricts the plugin
+	cmd.Lang = "custom"
+	if got, _ := cmd.matchLang("stub"); got {
+		t.Error("Expected the rule's lang to take precedence over the declared langs")
+	}
+}
+
+func TestCheckContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		ext         string
+		wantErr     bool
+	}{
+		{"", "png", false},
+		{"image/png", "png", false},
+		{"image/jpeg", "jpg", false},
+		{"image/svg+xml; charset=utf-8", "svg", false},
+		{"application/x-unknown", "png", false},
+		{"image/svg+xml", "png", true},
+	}
+	for _, tt := range tests {
+		err := checkContentType(tt.contentType, tt.ext)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkContentType(%q, %q) error = %v, wantErr %v", tt.contentType, tt.ext, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfig_findCommand_RememberedHandshake(t *testing.T) {
+	t.Setenv("LAMINATE_CACHE_PATH", t.TempDir())
+	// Not executable, so that any attempt to start it fails
+	plugin := filepath.Join(t.TempDir(), "stub")
+	if err := os.WriteFile(plugin, []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res := &pluginHandshake{Protocol: pluginProtocolVersion, Name: "stub", Langs: []string{"stub"}, Formats: []string{"svg"}}
+	if err := savePluginInfo(plugin, res); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{Commands: []*Command{{Plugin: plugin}}}
+	defer config.Close()
+	cmd, err := config.findCommand(context.Background(), "stub", nil)
+	if err != nil {
+		t.Fatalf("Expected the remembered handshake to match, got %v", err)
+	}
+	if cmd.GetExt() != "svg" {
+		t.Errorf("Expected ext svg, got %q", cmd.GetExt())
+	}
+	if config.workers != nil && len(config.workers.workers) != 0 {
+		t.Error("Expected no plugin to be started")
+	}
+
+	// A changed plugin is asked again
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(plugin, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadPluginInfo(plugin); ok {
+		t.Error("Expected the handshake of a changed plugin to be forgotten")
+	}
+}
+
+func TestConfig_findCommand_Wrapper(t *testing.T) {
+	t.Setenv("LAMINATE_CACHE_PATH", t.TempDir())
+	// Not executable, so that any attempt to start it fails
+	plugin := filepath.Join(t.TempDir(), "stub")
+	if err := os.WriteFile(plugin, []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{
+		Wrapper: []string{"env", "--"},
+		Commands: []*Command{
+			{Plugin: plugin},
+			{Lang: "custom", Plugin: plugin},
+			{Lang: "*"},
+		},
+	}
+	defer config.Close()
+
+	cmd, err := config.findCommand(context.Background(), "mermaid", nil)
+	if err != nil {
+		t.Fatalf("Expected the wrapped plugins to be passed over, got %v", err)
+	}
+	if cmd.Lang != "*" {
+		t.Errorf("Expected the rule *, got %q", cmd.name())
+	}
+
+	_, err = config.findCommand(context.Background(), "custom", nil)
+	var cerr *ConfigError
+	if !errors.As(err, &cerr) || !strings.Contains(err.Error(), "wrapper: []") {
+		t.Errorf("Expected a ConfigError about the wrapper, got: %v", err)
+	}
+	if config.workers != nil && len(config.workers.workers) != 0 {
+		t.Error("Expected no plugin to be started")
+	}
+}
@@ -0,0 +1,145 @@
+package laminate
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// Postprocess is the image post-processing applied in-process to the
+// output of a command, in the order of the fields
+type Postprocess struct {
+	Trim        bool    `yaml:"trim" json:"trim,omitempty"`           // remove uniform margins
+	Scale       float64 `yaml:"scale" json:"scale,omitempty"`         // scale factor
+	MaxWidth    int     `yaml:"max_width" json:"max_width,omitempty"` // shrink to fit, keeping the aspect ratio
+	MaxHeight   int     `yaml:"max_height" json:"max_height,omitempty"`
+	Padding     int     `yaml:"padding" json:"padding,omitempty"`       // pixels added on each side
+	Background  string  `yaml:"background" json:"background,omitempty"` // fills padding and transparency
+	Border      int     `yaml:"border" json:"border,omitempty"`         // border width in pixels
+	BorderColor string  `yaml:"border_color" json:"border_color,omitempty"`
+}
+
+// trimTolerance is how far, per 8-bit channel, a pixel may be from the
+// margin color and still be trimmed, to cope with JPEG artifacts
+const trimTolerance = 0x10
+
+// cacheKey returns the settings as a string taking part in the cache key,
+// so that changing them does not return stale images
+func (p *Postprocess) cacheKey() string {
+	if p == nil {
+		return ""
+	}
+	b, _ := json.Marshal(p)
+	return "\x00postprocess=" + string(b)
+}
+
+func (p *Postprocess) process(img image.Image) (image.Image, error) {
+	var bg, border rgba
+	if p.Background != "" {
+		var err error
+		if bg, err = parseColor(p.Background); err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("postprocess.background: %w", err)}
+		}
+	}
+	if p.Border > 0 {
+		var err error
+		if border, err = parseColor(cmp.Or(p.BorderColor, "#000000")); err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("postprocess.border_color: %w", err)}
+		}
+	}
+	if p.Scale < 0 || p.MaxWidth < 0 || p.MaxHeight < 0 || p.Padding < 0 || p.Border < 0 {
+		return nil, &ConfigError{Err: fmt.Errorf("postprocess settings must not be negative")}
+	}
+
+	if p.Trim {
+		img = trimMargins(img)
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if p.Scale > 0 {
+		w, h = int(float64(w)*p.Scale+0.5), int(float64(h)*p.Scale+0.5)
+	}
+	if p.MaxWidth > 0 && w > p.MaxWidth {
+		w, h = p.MaxWidth, h*p.MaxWidth/w
+	}
+	if p.MaxHeight > 0 && h > p.MaxHeight {
+		w, h = w*p.MaxHeight/h, p.MaxHeight
+	}
+	w, h = max(w, 1), max(h, 1)
+
+	margin := p.Padding + p.Border
+	dst := image.NewRGBA(image.Rect(0, 0, w+2*margin, h+2*margin))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(border), image.Point{}, draw.Src)
+	inner := dst.Bounds().Inset(p.Border)
+	draw.Draw(dst, inner, image.NewUniform(bg), image.Point{}, draw.Src)
+	target := dst.Bounds().Inset(margin)
+	if w == img.Bounds().Dx() && h == img.Bounds().Dy() {
+		draw.Draw(dst, target, img, img.Bounds().Min, draw.Over)
+	} else {
+		draw.CatmullRom.Scale(dst, target, img, img.Bounds(), draw.Over, nil)
+	}
+	return dst, nil
+}
+
+// trimMargins removes the margins of the color of the top-left pixel
+func trimMargins(img image.Image) image.Image {
+	b := img.Bounds()
+	ref := img.At(b.Min.X, b.Min.Y)
+	rowUniform := func(y int) bool {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !similarColor(img.At(x, y), ref) {
+				return false
+			}
+		}
+		return true
+	}
+	colUniform := func(x, minY, maxY int) bool {
+		for y := minY; y < maxY; y++ {
+			if !similarColor(img.At(x, y), ref) {
+				return false
+			}
+		}
+		return true
+	}
+
+	minY, maxY := b.Min.Y, b.Max.Y
+	for minY < maxY && rowUniform(minY) {
+		minY++
+	}
+	if minY == maxY {
+		// Entirely uniform, so keep a single pixel
+		return toRGBA(img).SubImage(image.Rect(0, 0, 1, 1))
+	}
+	for rowUniform(maxY - 1) {
+		maxY--
+	}
+	minX, maxX := b.Min.X, b.Max.X
+	for colUniform(minX, minY, maxY) {
+		minX++
+	}
+	for colUniform(maxX-1, minY, maxY) {
+		maxX--
+	}
+	r := image.Rect(minX, minY, maxX, maxY)
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	return toRGBA(img).SubImage(r.Sub(b.Min))
+}
+
+// similarColor reports whether the colors differ by at most trimTolerance
+// in every channel
+func similarColor(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	near := func(x, y uint32) bool {
+		d := int(x>>8) - int(y>>8)
+		return d >= -trimTolerance && d <= trimTolerance
+	}
+	return near(ar, br) && near(ag, bg) && near(ab, bb) && near(aa, ba)
+}
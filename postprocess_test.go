@@ -0,0 +1,84 @@
+package laminate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+// newTestImage returns a w x h white image with a black box at r
+func newTestImage(w, h int, r image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, r, image.NewUniform(color.Black), image.Point{}, draw.Src)
+	return img
+}
+
+func TestPostprocess_process(t *testing.T) {
+	src := newTestImage(100, 50, image.Rect(10, 20, 30, 40))
+	tests := []struct {
+		name string
+		p    Postprocess
+		w, h int
+	}{
+		{"none", Postprocess{}, 100, 50},
+		{"trim", Postprocess{Trim: true}, 20, 20},
+		{"scale", Postprocess{Scale: 0.5}, 50, 25},
+		{"max_width", Postprocess{MaxWidth: 40}, 40, 20},
+		{"max_height", Postprocess{MaxHeight: 10}, 20, 10},
+		{"max_width_not_needed", Postprocess{MaxWidth: 200}, 100, 50},
+		{"trim_then_padding_and_border", Postprocess{Trim: true, Padding: 5, Border: 2}, 34, 34},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := tt.p.process(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != tt.w || img.Bounds().Dy() != tt.h {
+				t.Errorf("Expected %dx%d, got %v", tt.w, tt.h, img.Bounds())
+			}
+		})
+	}
+}
+
+func TestPostprocess_Colors(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 4)) // fully transparent
+	p := &Postprocess{Padding: 2, Background: "#ff0000", Border: 1, BorderColor: "#0000ff"}
+	img, err := p.process(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{0, 0, 0xff, 0xff}}, // border
+		{1, 1, color.RGBA{0xff, 0, 0, 0xff}}, // padding
+		{5, 5, color.RGBA{0xff, 0, 0, 0xff}}, // flattened transparency
+		{9, 9, color.RGBA{0, 0, 0xff, 0xff}}, // border
+	}
+	for _, tt := range tests {
+		if got := color.RGBAModel.Convert(img.At(tt.x, tt.y)); got != tt.want {
+			t.Errorf("At(%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+
+	if _, err := (&Postprocess{Background: "nope"}).process(src); err == nil || !strings.Contains(err.Error(), "postprocess.background") {
+		t.Errorf("Expected a background error, got %v", err)
+	}
+}
+
+func TestPostprocess_cacheKey(t *testing.T) {
+	var none *Postprocess
+	if none.cacheKey() != "" {
+		t.Error("Expected no cache key without postprocess, keeping existing keys")
+	}
+	a := (&Postprocess{Scale: 0.5}).cacheKey()
+	b := (&Postprocess{Scale: 2}).cacheKey()
+	if a == "" || a == b {
+		t.Errorf("Expected distinct cache keys, got %q and %q", a, b)
+	}
+}
@@ -0,0 +1,47 @@
+package laminate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boombuler/barcode/qr"
+)
+
+// qrLevels are the error correction levels of QR codes
+var qrLevels = map[string]qr.ErrorCorrectionLevel{
+	"L": qr.L,
+	"M": qr.M,
+	"Q": qr.Q,
+	"H": qr.H,
+}
+
+// renderQR encodes the input as a QR code. Trailing newlines, such as the
+// one added by echo, are dropped unless trim is false.
+func renderQR(req *builtinRequest) ([]byte, error) {
+	content := req.input
+	if req.get("trim", "true") != "false" {
+		content = strings.TrimRight(content, "\r\n")
+	}
+	level, ok := qrLevels[strings.ToUpper(req.get("level", "M"))]
+	if !ok {
+		return nil, fmt.Errorf("level must be one of L, M, Q and H: %q", req.vars["level"])
+	}
+	moduleSize, err := req.int("module_size", 8, 1, 64)
+	if err != nil {
+		return nil, err
+	}
+	style := &matrixStyle{moduleWidth: moduleSize, moduleHeight: moduleSize}
+	if style.quietX, err = req.int("quiet_zone", 4, 0, 64); err != nil {
+		return nil, err
+	}
+	style.quietY = style.quietX
+	if err := style.setColors(req); err != nil {
+		return nil, err
+	}
+
+	bc, err := qr.Encode(content, level, qr.Auto)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	return newModuleMatrix(bc).render(req.format, style)
+}
@@ -0,0 +1,82 @@
+package laminate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRenderQR(t *testing.T) {
+	render := func(input, format string, vars map[string]string) []byte {
+		t.Helper()
+		data, err := renderQR(&builtinRequest{lang: "qr", input: input, format: format, vars: vars})
+		if err != nil {
+			t.Fatalf("renderQR() error = %v", err)
+		}
+		return data
+	}
+
+	// Version 1 has 21 modules, plus 4 modules of quiet zone on each side
+	img := decodeTestPNG(t, render("hello", "png", nil))
+	if got, want := img.Bounds().Dx(), (21+8)*8; got != want || img.Bounds().Dy() != want {
+		t.Errorf("Expected %dx%d, got %v", want, want, img.Bounds())
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xffff {
+		t.Errorf("Expected a white quiet zone, got %v", img.At(0, 0))
+	}
+	if r, _, _, _ := img.At(4*8, 4*8).RGBA(); r != 0 {
+		t.Errorf("Expected the finder pattern to be black, got %v", img.At(4*8, 4*8))
+	}
+
+	small := decodeTestPNG(t, render("hello", "png", map[string]string{"module_size": "2", "quiet_zone": "0"}))
+	if got := small.Bounds().Dx(); got != 21*2 {
+		t.Errorf("Expected %d, got %d", 21*2, got)
+	}
+
+	if !bytes.Equal(render("hello", "png", nil), render("hello", "png", nil)) {
+		t.Error("Expected identical output for identical input")
+	}
+	if !bytes.Equal(render("hello\n", "png", nil), render("hello", "png", nil)) {
+		t.Error("Expected the trailing newline to be trimmed")
+	}
+	if bytes.Equal(render("hello\n", "png", map[string]string{"trim": "false"}), render("hello", "png", nil)) {
+		t.Error("Expected the trailing newline to be kept with trim=false")
+	}
+	if bytes.Equal(render("hello", "png", map[string]string{"level": "h"}), render("hello", "png", nil)) {
+		t.Error("Expected the error correction level to change the code")
+	}
+}
+
+func TestRenderQR_SVG(t *testing.T) {
+	data, err := renderQR(&builtinRequest{input: "hello", format: "svg", vars: map[string]string{"foreground": "#336699"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertWellFormedSVG(t, data)
+	for _, want := range []string{`width="232" height="232"`, `fill="#336699"`, `<path`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected SVG to contain %q, got:\n%s", want, data)
+		}
+	}
+	if detectFormat(data) != "svg" {
+		t.Errorf("Expected the output to be detected as SVG")
+	}
+}
+
+func TestRenderQR_Errors(t *testing.T) {
+	tests := []struct {
+		vars   map[string]string
+		errMsg string
+	}{
+		{map[string]string{"level": "X"}, "level must be one of L, M, Q and H"},
+		{map[string]string{"module_size": "0"}, "module_size must be an integer from 1 to 64"},
+		{map[string]string{"module_size": "100000"}, "module_size must be an integer from 1 to 64"},
+		{map[string]string{"background": "nope"}, "background: invalid color"},
+	}
+	for _, tt := range tests {
+		_, err := renderQR(&builtinRequest{input: "x", format: "png", vars: tt.vars})
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("renderQR(%v) error = %v, want %q", tt.vars, err, tt.errMsg)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package laminate
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// RetryPolicy configures how a failing command is retried
+type RetryPolicy struct {
+	Attempts int           `yaml:"attempts"` // total number of attempts, including the first
+	Backoff  time.Duration `yaml:"backoff"`  // wait before the first retry, doubled for each further retry
+	On       RetryOn       `yaml:"on"`
+}
+
+// RetryOn holds the conditions under which a failure is retried. Without any
+// condition every command failure is retried; timeouts never are.
+type RetryOn struct {
+	ExitCodes []int  `yaml:"exit_codes"`
+	Stderr    string `yaml:"stderr"` // regular expression matched against stderr
+}
+
+// shouldRetry reports whether the command should be run again after the
+// given attempt failed with err, and how long to wait before doing so
+func (p *RetryPolicy) shouldRetry(attempt int, err error) (time.Duration, bool, error) {
+	if p == nil || attempt >= p.Attempts {
+		return 0, false, nil
+	}
+	var cerr *CommandError
+	if !errors.As(err, &cerr) {
+		return 0, false, nil
+	}
+	matched := p.On.ExitCodes == nil && p.On.Stderr == ""
+	if slices.Contains(p.On.ExitCodes, cerr.ExitStatus) {
+		matched = true
+	}
+	if p.On.Stderr != "" {
+		reg, err := regexp.Compile(p.On.Stderr)
+		if err != nil {
+			return 0, false, &ConfigError{Err: fmt.Errorf("invalid retry stderr pattern %q: %w", p.On.Stderr, err)}
+		}
+		if reg.MatchString(cerr.Stderr) {
+			matched = true
+		}
+	}
+	if !matched {
+		return 0, false, nil
+	}
+	return p.Backoff << (attempt - 1), true, nil
+}
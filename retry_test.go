@@ -0,0 +1,52 @@
+package laminate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_shouldRetry(t *testing.T) {
+	cmdErr := func(status int, stderr string) error {
+		return &CommandError{Argv: []string{"mmdc"}, ExitStatus: status, Stderr: stderr, Err: errors.New("exit status")}
+	}
+	tests := []struct {
+		name     string
+		policy   *RetryPolicy
+		attempt  int
+		err      error
+		retry    bool
+		wait     time.Duration
+		hasError bool
+	}{
+		{"no_policy", nil, 1, cmdErr(1, ""), false, 0, false},
+		{"any_failure", &RetryPolicy{Attempts: 3, Backoff: time.Second}, 1, cmdErr(1, ""), true, time.Second, false},
+		{"exponential_backoff", &RetryPolicy{Attempts: 3, Backoff: time.Second}, 2, cmdErr(1, ""), true, 2 * time.Second, false},
+		{"attempts_exhausted", &RetryPolicy{Attempts: 3, Backoff: time.Second}, 3, cmdErr(1, ""), false, 0, false},
+		{"timeout_not_retried", &RetryPolicy{Attempts: 3}, 1, &TimeoutError{Argv: []string{"mmdc"}}, false, 0, false},
+		{"exit_code_match", &RetryPolicy{Attempts: 2, On: RetryOn{ExitCodes: []int{3, 4}}}, 1, cmdErr(4, ""), true, 0, false},
+		{"exit_code_no_match", &RetryPolicy{Attempts: 2, On: RetryOn{ExitCodes: []int{3}}}, 1, cmdErr(1, ""), false, 0, false},
+		{"stderr_match", &RetryPolicy{Attempts: 2, On: RetryOn{Stderr: `(?i)failed to launch`}}, 1, cmdErr(1, "Error: Failed to launch the browser process"), true, 0, false},
+		{"stderr_no_match", &RetryPolicy{Attempts: 2, On: RetryOn{Stderr: `Failed to launch`}}, 1, cmdErr(1, "Parse error on line 2"), false, 0, false},
+		{"exit_code_or_stderr", &RetryPolicy{Attempts: 2, On: RetryOn{ExitCodes: []int{3}, Stderr: "ECONNRESET"}}, 1, cmdErr(1, "read ECONNRESET"), true, 0, false},
+		{"invalid_stderr_pattern", &RetryPolicy{Attempts: 2, On: RetryOn{Stderr: `(`}}, 1, cmdErr(1, ""), false, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, retry, err := tt.policy.shouldRetry(tt.attempt, tt.err)
+			if tt.hasError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if retry != tt.retry || wait != tt.wait {
+				t.Errorf("Expected (%s, %v), got (%s, %v)", tt.wait, tt.retry, wait, retry)
+			}
+		})
+	}
+}
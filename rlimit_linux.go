@@ -0,0 +1,27 @@
+//go:build linux
+
+package laminate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rlimitArgv returns an argv prefix that sets the resource limits in a shell
+// and then execs the command. The limits are thus in place before the command
+// runs, and every process it forks inherits them.
+func rlimitArgv(r *Rlimits) ([]string, error) {
+	var script []string
+	if r.CPUSeconds > 0 {
+		script = append(script, fmt.Sprintf("ulimit -t %d", r.CPUSeconds))
+	}
+	if r.AddressSpace > 0 {
+		// ulimit takes KiB
+		script = append(script, fmt.Sprintf("ulimit -v %d", (r.AddressSpace+1023)/1024))
+	}
+	if r.OpenFiles > 0 {
+		script = append(script, fmt.Sprintf("ulimit -n %d", r.OpenFiles))
+	}
+	script = append(script, `exec "$@"`)
+	return []string{"/bin/sh", "-c", strings.Join(script, " && "), "sh"}, nil
+}
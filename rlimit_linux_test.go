@@ -0,0 +1,41 @@
+//go:build linux
+
+package laminate
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRlimitArgv(t *testing.T) {
+	prefix, err := rlimitArgv(&Rlimits{CPUSeconds: 7, OpenFiles: 32, AddressSpace: 1 << 30})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The limits must also hold in processes the command forks, such as the
+	// cat of this pipeline
+	argv := append(prefix, "sh", "-c", "cat /proc/self/limits | cat")
+	b, err := exec.Command(argv[0], argv[1:]...).Output()
+	if err != nil {
+		t.Skipf("/proc is not available: %v", err)
+	}
+	for _, expected := range [][]string{
+		{"Max cpu time", "7", "7"},
+		{"Max open files", "32", "32"},
+		{"Max address space", "1073741824", "1073741824"},
+	} {
+		found := false
+		for _, line := range strings.Split(string(b), "\n") {
+			if strings.HasPrefix(line, expected[0]) {
+				found = true
+				if fields := strings.Fields(line[len(expected[0]):]); fields[0] != expected[1] || fields[1] != expected[2] {
+					t.Errorf("Expected %s to be %v, got %q", expected[0], expected[1:], line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s not found in limits", expected[0])
+		}
+	}
+}
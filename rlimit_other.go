@@ -0,0 +1,13 @@
+//go:build !linux
+
+package laminate
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// rlimitArgv is not supported on this platform
+func rlimitArgv(r *Rlimits) ([]string, error) {
+	return nil, fmt.Errorf("rlimits are not supported on %s", runtime.GOOS)
+}
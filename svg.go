@@ -0,0 +1,39 @@
+package laminate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// svgFill returns the fill attribute for the color, with fill-opacity when it
+// is translucent
+func svgFill(c rgba) string {
+	return svgPaint("fill", c)
+}
+
+// svgPaint returns the attribute of the given name, fill or stroke, for the
+// color, with its opacity when it is translucent
+func svgPaint(attr string, c rgba) string {
+	if c.A == 0 {
+		return attr + `="none"`
+	}
+	s := fmt.Sprintf(`%s="#%02x%02x%02x"`, attr, c.R, c.G, c.B)
+	if c.A != 0xff {
+		s += fmt.Sprintf(` %s-opacity="%s"`, attr, strconv.FormatFloat(float64(c.A)/0xff, 'f', 3, 64))
+	}
+	return s
+}
+
+// svgEscape escapes text for SVG content and attribute values
+func svgEscape(s string) string {
+	return svgEscaper.Replace(s)
+}
+
+var svgEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&#39;",
+)
@@ -0,0 +1,287 @@
+package laminate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+type tableAlign int
+
+const (
+	alignLeft tableAlign = iota
+	alignCenter
+	alignRight
+)
+
+// table is a grid of cells, the first row being the header
+type table struct {
+	rows  [][]string
+	align []tableAlign
+}
+
+// markdownDelimiterReg matches the delimiter row of a markdown table, such
+// as `|:---|--:|`
+var markdownDelimiterReg = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+
+// markdownBreakReg matches line breaks written in markdown table cells
+var markdownBreakReg = regexp.MustCompile(`(?i)<br\s*/?>`)
+
+// renderTable draws CSV, TSV or a markdown table as a grid
+func renderTable(req *builtinRequest) ([]byte, error) {
+	tbl, err := parseTable(req.input)
+	if err != nil {
+		return nil, err
+	}
+	if err := tbl.setAlign(req.get("align", "")); err != nil {
+		return nil, err
+	}
+	cellPadding, err := req.int("cell_padding", 8, 0, 256)
+	if err != nil {
+		return nil, err
+	}
+	headerBg, err := req.color("header_background", "#eaeef2")
+	if err != nil {
+		return nil, err
+	}
+	stripe, err := req.color("stripe_background", "#f6f8fa")
+	if err != nil {
+		return nil, err
+	}
+	border, err := req.color("border_color", "#d0d7de")
+	if err != nil {
+		return nil, err
+	}
+
+	style, err := newTextStyle(req)
+	if err != nil {
+		return nil, err
+	}
+	defer style.face.Close()
+	header, err := headerStyle(req, style)
+	if err != nil {
+		return nil, err
+	}
+	defer header.face.Close()
+
+	// Column widths and row heights, in whole pixels for crisp lines
+	padX, padY := cellPadding, cellPadding/2
+	lh := style.lineHeight()
+	colWidths := make([]int, len(tbl.align))
+	rowHeights := make([]int, len(tbl.rows))
+	for i, row := range tbl.rows {
+		st := style
+		if i == 0 {
+			st = header
+		}
+		for j, cell := range row {
+			lines := splitLines(cell)
+			for _, l := range lines {
+				colWidths[j] = max(colWidths[j], st.textWidth(l).Ceil()+2*padX)
+			}
+			rowHeights[i] = max(rowHeights[i], len(lines)*lh+2*padY)
+		}
+	}
+	var tableWidth, tableHeight int
+	for _, w := range colWidths {
+		tableWidth += w
+	}
+	for _, h := range rowHeights {
+		tableHeight += h
+	}
+	pad := style.padding
+	cv, err := newCanvas(req.format, tableWidth+2*pad+1, tableHeight+2*pad+1, style.bg)
+	if err != nil {
+		return nil, err
+	}
+
+	ascent := float64(style.face.Metrics().Ascent) / 64
+	y := pad
+	for i, row := range tbl.rows {
+		st, bg := style, rgba{}
+		switch {
+		case i == 0:
+			st, bg = header, headerBg
+		case i%2 == 0:
+			bg = stripe
+		}
+		if bg.A != 0 {
+			fillRect(cv, float64(pad), float64(y), float64(tableWidth), float64(rowHeights[i]), bg)
+		}
+		x := pad
+		for j, cell := range row {
+			for k, l := range splitLines(cell) {
+				tx := float64(x + padX)
+				switch w := float64(st.textWidth(l)) / 64; tbl.align[j] {
+				case alignCenter:
+					tx = float64(x) + (float64(colWidths[j])-w)/2
+				case alignRight:
+					tx = float64(x+colWidths[j]-padX) - w
+				}
+				cv.text(st, tx, float64(y+padY+k*lh)+ascent, l, style.fg)
+			}
+			x += colWidths[j]
+		}
+		y += rowHeights[i]
+	}
+
+	// Grid lines on pixel centers
+	left, top := float64(pad)+0.5, float64(pad)+0.5
+	y = pad
+	for i := range len(rowHeights) + 1 {
+		cv.polyline([]point{{left, float64(y) + 0.5}, {left + float64(tableWidth), float64(y) + 0.5}}, 1, border)
+		if i < len(rowHeights) {
+			y += rowHeights[i]
+		}
+	}
+	x := pad
+	for j := range len(colWidths) + 1 {
+		cv.polyline([]point{{float64(x) + 0.5, top}, {float64(x) + 0.5, top + float64(tableHeight)}}, 1, border)
+		if j < len(colWidths) {
+			x += colWidths[j]
+		}
+	}
+	return cv.encode()
+}
+
+// headerStyle returns the style of header cells, in the bold_font var, or
+// Go Mono Bold when no font is set, or else in the font itself
+func headerStyle(req *builtinRequest, style *textStyle) (*textStyle, error) {
+	header := *style
+	header.buf = sfnt.Buffer{}
+	var err error
+	switch path := req.get("bold_font", ""); {
+	case path != "":
+		header.font, err = loadFont(path)
+		header.bold = true
+	case req.get("font", "") == "":
+		header.font, err = opentype.Parse(gomonobold.TTF)
+		header.bold = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := header.setFace(); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// parseTable parses a markdown table, recognized by its delimiter row, or
+// else CSV or TSV. Columns of CSV and TSV are right aligned when all their
+// cells are numbers.
+func parseTable(input string) (*table, error) {
+	lines := splitLines(strings.TrimSpace(input))
+	if len(lines) >= 2 && strings.Contains(lines[0], "|") && markdownDelimiterReg.MatchString(strings.TrimSpace(lines[1])) {
+		return parseMarkdownTable(lines), nil
+	}
+	records, err := readDelimited(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("nothing to draw")
+	}
+	tbl := &table{rows: records, align: make([]tableAlign, len(records[0]))}
+	for j := range tbl.align {
+		numeric := false
+		for _, row := range records[1:] {
+			cell := strings.TrimSpace(row[j])
+			if cell == "" {
+				continue
+			}
+			if _, err := strconv.ParseFloat(cell, 64); err != nil {
+				numeric = false
+				break
+			}
+			numeric = true
+		}
+		if numeric {
+			tbl.align[j] = alignRight
+		}
+	}
+	return tbl, nil
+}
+
+// parseMarkdownTable parses a GitHub flavored markdown table. Rows are cut
+// or padded to the width of the header, and `<br>` breaks lines.
+func parseMarkdownTable(lines []string) *table {
+	header := splitMarkdownRow(lines[0])
+	tbl := &table{align: make([]tableAlign, len(header))}
+	for j, cell := range splitMarkdownRow(lines[1]) {
+		if j >= len(header) {
+			break
+		}
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			tbl.align[j] = alignCenter
+		case strings.HasSuffix(cell, ":"):
+			tbl.align[j] = alignRight
+		}
+	}
+	for i, line := range lines {
+		if i == 1 || strings.TrimSpace(line) == "" {
+			continue
+		}
+		row := make([]string, len(header))
+		for j, cell := range splitMarkdownRow(line) {
+			if j < len(row) {
+				row[j] = markdownBreakReg.ReplaceAllString(cell, "\n")
+			}
+		}
+		tbl.rows = append(tbl.rows, row)
+	}
+	return tbl
+}
+
+// splitMarkdownRow splits a markdown table row into trimmed cells, on pipes
+// other than escaped ones
+func splitMarkdownRow(line string) []string {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var (
+		cells []string
+		b     strings.Builder
+	)
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			b.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(b.String()))
+}
+
+// setAlign overrides the alignment of the columns, in order, with a list of
+// left, center and right
+func (tbl *table) setAlign(s string) error {
+	for j, a := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if j >= len(tbl.align) {
+			break
+		}
+		switch strings.ToLower(a) {
+		case "left", "l":
+			tbl.align[j] = alignLeft
+		case "center", "c":
+			tbl.align[j] = alignCenter
+		case "right", "r":
+			tbl.align[j] = alignRight
+		default:
+			return fmt.Errorf("align must be a list of left, center and right: %q", s)
+		}
+	}
+	return nil
+}
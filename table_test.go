@@ -0,0 +1,126 @@
+package laminate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *table
+	}{
+		{
+			name:  "markdown",
+			input: "| a | b | c |\n|:--|:-:|--:|\n| x \\| y | 1<br>2 |\n| p | q | r | s |\n",
+			want: &table{
+				rows:  [][]string{{"a", "b", "c"}, {"x | y", "1\n2", ""}, {"p", "q", "r"}},
+				align: []tableAlign{alignLeft, alignCenter, alignRight},
+			},
+		},
+		{
+			name:  "markdown_without_outer_pipes",
+			input: "a | b\n--- | ---\n1 | 2",
+			want: &table{
+				rows:  [][]string{{"a", "b"}, {"1", "2"}},
+				align: []tableAlign{alignLeft, alignLeft},
+			},
+		},
+		{
+			name:  "csv",
+			input: "name,price,note\nwidget,1.50,\ngadget,12,\"a, b\"\n",
+			want: &table{
+				rows:  [][]string{{"name", "price", "note"}, {"widget", "1.50", ""}, {"gadget", "12", "a, b"}},
+				align: []tableAlign{alignLeft, alignRight, alignLeft},
+			},
+		},
+		{
+			name:  "tsv",
+			input: "a\tb\n1\tx|y\n",
+			want: &table{
+				rows:  [][]string{{"a", "b"}, {"1", "x|y"}},
+				align: []tableAlign{alignRight, alignLeft},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTable(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTable_SetAlign(t *testing.T) {
+	tbl := &table{align: make([]tableAlign, 3)}
+	if err := tbl.setAlign("right, c"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []tableAlign{alignRight, alignCenter, alignLeft}; !reflect.DeepEqual(tbl.align, want) {
+		t.Errorf("Expected %v, got %v", want, tbl.align)
+	}
+	if err := tbl.setAlign("middle"); err == nil || !strings.Contains(err.Error(), "align must be a list of left, center and right") {
+		t.Errorf("Expected an align error, got %v", err)
+	}
+}
+
+func TestRenderTable(t *testing.T) {
+	render := func(input, format string, vars map[string]string) []byte {
+		t.Helper()
+		data, err := renderTable(&builtinRequest{lang: "table", input: input, format: format, vars: vars})
+		if err != nil {
+			t.Fatalf("renderTable() error = %v", err)
+		}
+		return data
+	}
+
+	// Wide characters take two columns, so both tables are as wide
+	ascii := decodeTestPNG(t, render("name\nabcd\n", "png", nil))
+	wide := decodeTestPNG(t, render("name\n日本\n", "png", nil))
+	if ascii.Bounds() != wide.Bounds() {
+		t.Errorf("Expected %v, got %v", ascii.Bounds(), wide.Bounds())
+	}
+	// Two rows of one line each, with padding, cell padding and grid lines
+	style, err := newTextStyle(&builtinRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer style.face.Close()
+	lh := style.lineHeight()
+	if want := 2*(lh+8) + 2*16 + 1; ascii.Bounds().Dy() != want {
+		t.Errorf("Expected height %d, got %d", want, ascii.Bounds().Dy())
+	}
+
+	svg := render("| a | b |\n|---|---|\n| <1> | 2 |\n", "svg", map[string]string{"border_color": "#ff0000"})
+	assertWellFormedSVG(t, svg)
+	for _, want := range []string{`font-weight="bold"`, `stroke="#ff0000"`, "&lt;1&gt;"} {
+		if !strings.Contains(string(svg), want) {
+			t.Errorf("Expected SVG to contain %q, got:\n%s", want, svg)
+		}
+	}
+}
+
+func TestRenderTable_Errors(t *testing.T) {
+	tests := []struct {
+		input  string
+		vars   map[string]string
+		errMsg string
+	}{
+		{"", nil, "nothing to draw"},
+		{"a,b\n1\n", nil, "wrong number of fields"},
+		{"a,b\n1,2\n", map[string]string{"stripe_background": "striped"}, `stripe_background: invalid color "striped"`},
+	}
+	for _, tt := range tests {
+		_, err := renderTable(&builtinRequest{input: tt.input, format: "png", vars: tt.vars})
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("renderTable(%q, %v) error = %v, want %q", tt.input, tt.vars, err, tt.errMsg)
+		}
+	}
+}
@@ -2,19 +2,62 @@ package laminate
 
 import (
 	"regexp"
-	"strings"
 )
 
-var templateVarPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9]+)\s*\}\}`)
+var (
+	templateVarPattern  = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_]+)\s*(?::-([^}]*?))?\s*\}\}`)
+	argConditionPattern = regexp.MustCompile(`^\{\{\?\s*([a-zA-Z0-9_]+)\s*\}\}`)
+	templateVarNameReg  = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	splatVarPattern     = regexp.MustCompile(`^\{\{\s*([a-zA-Z0-9_]+)\.\.\.\s*\}\}$`)
+)
 
-// ExpandTemplate expands template variables in a command string
+// ExpandTemplate expands template variables in a command string.
+// A variable may carry a default value, as in {{theme:-Dracula}}, which is
+// used when the variable is unset or empty.
 func ExpandTemplate(template string, vars map[string]string) (string, error) {
 	result := templateVarPattern.ReplaceAllStringFunc(template, func(match string) string {
-		varName := strings.TrimSpace(match[2 : len(match)-2]) // Remove '{{' and '}}'
-		if value, ok := vars[varName]; ok {
+		m := templateVarPattern.FindStringSubmatchIndex(match)
+		varName, hasDefault := match[m[2]:m[3]], m[4] >= 0
+		if value, ok := vars[varName]; ok && (value != "" || !hasDefault) {
 			return value
 		}
+		if hasDefault {
+			return match[m[4]:m[5]]
+		}
 		return match
 	})
 	return result, nil
 }
+
+// expandArg expands a single element of an array command into zero or more
+// argv elements. The element may be prefixed by one or more {{?var}}
+// conditions; when any of those variables is unset or empty the element is
+// dropped. An element consisting solely of {{var...}} is a splat: it expands
+// to one argv element per non-empty value of the list variable var. Any other
+// element is expanded by expand.
+func expandArg(template string, vars map[string]string, lists map[string][]string, expand func(string) (string, error)) ([]string, error) {
+	for {
+		m := argConditionPattern.FindStringSubmatch(template)
+		if m == nil {
+			break
+		}
+		if vars[m[1]] == "" {
+			return nil, nil
+		}
+		template = template[len(m[0]):]
+	}
+	if m := splatVarPattern.FindStringSubmatch(template); m != nil {
+		var args []string
+		for _, v := range lists[m[1]] {
+			if v != "" {
+				args = append(args, v)
+			}
+		}
+		return args, nil
+	}
+	arg, err := expand(template)
+	if err != nil {
+		return nil, err
+	}
+	return []string{arg}, nil
+}
@@ -1,6 +1,7 @@
 package laminate
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -41,6 +42,30 @@ func TestExpandTemplate(t *testing.T) {
 			map[string]string{"input": "test"},
 			"echo test and test again",
 		},
+		{
+			"default_for_missing_variable",
+			"--theme={{theme:-Dracula}}",
+			map[string]string{},
+			"--theme=Dracula",
+		},
+		{
+			"default_for_empty_variable",
+			"--theme={{ theme:-Dracula }}",
+			map[string]string{"theme": ""},
+			"--theme=Dracula",
+		},
+		{
+			"default_not_used",
+			"--theme={{theme:-Dracula}}",
+			map[string]string{"theme": "Nord"},
+			"--theme=Nord",
+		},
+		{
+			"empty_default",
+			"[{{theme:-}}]",
+			map[string]string{},
+			"[]",
+		},
 	}
 
 	for _, tt := range tests {
@@ -55,3 +80,49 @@ func TestExpandTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandArg(t *testing.T) {
+	vars := map[string]string{"theme": "Nord", "empty": "", "lang": "go", "include": "a b"}
+	lists := map[string][]string{
+		"theme":   {"Nord"},
+		"empty":   {""},
+		"lang":    {"go"},
+		"include": {"a", "b"},
+	}
+	tests := []struct {
+		name     string
+		template string
+		expected []string
+	}{
+		{"plain", "{{lang}}", []string{"go"}},
+		{"condition_met", "{{?theme}}--theme={{theme}}", []string{"--theme=Nord"}},
+		{"condition_empty", "{{?empty}}--x={{empty}}", nil},
+		{"condition_missing", "{{?missing}}--x", nil},
+		{"multiple_conditions", "{{?theme}}{{? lang }}{{lang}}:{{theme}}", []string{"go:Nord"}},
+		{"multiple_conditions_one_missing", "{{?theme}}{{?missing}}x", nil},
+		{"condition_not_at_start", "x{{?missing}}", []string{"x{{?missing}}"}},
+		{"empty_value_kept_without_condition", "{{empty}}", []string{""}},
+		{"list_as_scalar", "-I{{include}}", []string{"-Ia b"}},
+		{"splat", "{{include...}}", []string{"a", "b"}},
+		{"splat_with_spaces", "{{ include... }}", []string{"a", "b"}},
+		{"splat_scalar", "{{theme...}}", []string{"Nord"}},
+		{"splat_empty", "{{empty...}}", nil},
+		{"splat_missing", "{{missing...}}", nil},
+		{"splat_with_condition", "{{?include}}{{include...}}", []string{"a", "b"}},
+		{"splat_not_alone", "-I{{include...}}", []string{"-I{{include...}}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := expandArg(tt.template, vars, lists, func(s string) (string, error) {
+				return ExpandTemplate(s, vars)
+			})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
 	"os"
 	"strings"
 )
@@ -29,34 +35,19 @@ func main() {
 	// Use input to avoid unused variable error
 	_ = input
 
-	// Generate fake image content
-	var imageContent []byte
+	// Generate a small but valid image
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0x33, 0x66, 0x99, 0xff}}, image.Point{}, draw.Src)
+	var buf bytes.Buffer
 
 	// Check output file extension to determine format
 	if output != "" && strings.HasSuffix(strings.ToLower(output), ".jpg") {
-		// Generate fake JPEG content
-		imageContent = []byte{
-			0xFF, 0xD8, 0xFF, 0xE0, // JPEG signature
-			0x00, 0x10, 0x4A, 0x46, 0x49, 0x46, 0x00, 0x01, // JFIF header
-			0x01, 0x01, 0x00, 0x48, 0x00, 0x48, 0x00, 0x00,
-			0xFF, 0xDB, 0x00, 0x43, 0x00, // Quantization table
-			// Minimal JPEG data (truncated for brevity)
-			0xFF, 0xD9, // End of Image
-		}
+		jpeg.Encode(&buf, img, nil)
 	} else {
-		// Generate fake PNG content (default)
-		imageContent = []byte{
-			0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A, // PNG signature
-			0x00, 0x00, 0x00, 0x0D, // IHDR chunk length
-			0x49, 0x48, 0x44, 0x52, // IHDR
-			0x00, 0x00, 0x00, 0x10, // width: 16
-			0x00, 0x00, 0x00, 0x10, // height: 16
-			0x08, 0x02, 0x00, 0x00, 0x00, // bit depth, color type, compression, filter, interlace
-			0x90, 0x91, 0x68, 0x36, // CRC
-			0x00, 0x00, 0x00, 0x0C, // IEND chunk length
-			0x49, 0x45, 0x4E, 0x44, 0xAE, 0x42, 0x60, 0x82, // IEND
-		}
+		// PNG (default)
+		png.Encode(&buf, img)
 	}
+	imageContent := buf.Bytes()
 
 	if output != "" {
 		// Write to file
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+)
+
+// A stub plugin speaking laminate's plugin protocol. It declares the stub and
+// stub-* langs and renders PNG, except for the input "fail".
+func main() {
+	r := bufio.NewReader(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req struct {
+			Type     string              `json:"type"`
+			ID       int                 `json:"id"`
+			Protocol int                 `json:"protocol"`
+			Lang     string              `json:"lang"`
+			Input    string              `json:"input"`
+			Vars     map[string][]string `json:"vars"`
+		}
+		if err := json.Unmarshal(line, &req); err != nil {
+			os.Exit(2)
+		}
+		switch req.Type {
+		case "handshake":
+			enc.Encode(map[string]any{
+				"protocol": req.Protocol,
+				"name":     "stub",
+				"langs":    []string{"stub", "stub-*"},
+				"formats":  []string{"png"},
+			})
+		case "render":
+			res := map[string]any{"id": req.ID}
+			if req.Input == "fail" {
+				res["error"] = "cannot render"
+				res["diagnostics"] = []string{"stub: bad input"}
+			} else {
+				img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+				draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0x33, 0x66, 0x99, 0xff}}, image.Point{}, draw.Src)
+				var buf bytes.Buffer
+				png.Encode(&buf, img)
+				res["data"] = buf.Bytes()
+				res["content_type"] = "image/png"
+				res["diagnostics"] = []string{fmt.Sprintf("stub: rendered %s with theme %v", req.Lang, req.Vars["theme"])}
+			}
+			enc.Encode(res)
+		default:
+			enc.Encode(map[string]any{"id": req.ID, "error": "unknown request type"})
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+)
+
+// A stub worker speaking laminate's worker protocol. The input "crash" makes
+// it exit without responding and "fail" makes it respond with an error.
+func main() {
+	r := bufio.NewReader(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req struct {
+			ID    int    `json:"id"`
+			Input string `json:"input"`
+		}
+		if err := json.Unmarshal(line, &req); err != nil {
+			os.Exit(2)
+		}
+		res := struct {
+			ID    int    `json:"id"`
+			Data  []byte `json:"data,omitempty"`
+			Error string `json:"error,omitempty"`
+		}{ID: req.ID}
+		switch req.Input {
+		case "crash":
+			os.Exit(1)
+		case "fail":
+			res.Error = "cannot render"
+		default:
+			img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+			draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0x33, 0x66, 0x99, 0xff}}, image.Point{}, draw.Src)
+			var buf bytes.Buffer
+			png.Encode(&buf, img)
+			res.Data = buf.Bytes()
+		}
+		enc.Encode(res)
+	}
+}
@@ -0,0 +1,253 @@
+package laminate
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// textStyle is the look of text drawn by the text-based builtins, taken
+// from the font, font_size, padding, foreground, background and tab_width
+// vars
+type textStyle struct {
+	font      *sfnt.Font
+	face      font.Face
+	fontSize  float64
+	padding   int
+	fg, bg    rgba
+	tabWidth  int
+	highlight rgba          // background of highlighted lines
+	bold      bool          // the font is a bold one
+	cell      fixed.Int26_6 // advance of a single-column glyph
+	buf       sfnt.Buffer
+}
+
+// textSpan is a run of text in a single color
+type textSpan struct {
+	text  string
+	color rgba
+}
+
+// textLine is a line of text, without the newline
+type textLine struct {
+	spans     []textSpan
+	highlight bool
+}
+
+func renderText(req *builtinRequest) ([]byte, error) {
+	style, err := newTextStyle(req)
+	if err != nil {
+		return nil, err
+	}
+	defer style.face.Close()
+	return style.render(style.plainLines(req.input), req.format)
+}
+
+func newTextStyle(req *builtinRequest) (*textStyle, error) {
+	var (
+		style = &textStyle{}
+		err   error
+	)
+	if style.fontSize, err = req.float("font_size", 16, 512); err != nil {
+		return nil, err
+	}
+	if style.padding, err = req.int("padding", 16, 0, 1024); err != nil {
+		return nil, err
+	}
+	if style.tabWidth, err = req.int("tab_width", 4, 1, 32); err != nil {
+		return nil, err
+	}
+	if style.fg, err = req.color("foreground", "#000000"); err != nil {
+		return nil, err
+	}
+	if style.bg, err = req.color("background", "#ffffff"); err != nil {
+		return nil, err
+	}
+	if style.font, err = loadFont(req.get("font", "")); err != nil {
+		return nil, err
+	}
+	if err := style.setFace(); err != nil {
+		return nil, err
+	}
+	return style, nil
+}
+
+// setFace sets up the face of the font at the font size
+func (style *textStyle) setFace() error {
+	face, err := opentype.NewFace(style.font, &opentype.FaceOptions{
+		Size:    style.fontSize,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load font: %w", err)
+	}
+	style.face = face
+	style.cell, _ = style.face.GlyphAdvance('0')
+	return nil
+}
+
+// loadFont loads a TrueType or OpenType font file, taking the first font of
+// a collection. An empty path selects Go Mono.
+func loadFont(path string) (*sfnt.Font, error) {
+	data := gomono.TTF
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read font: %w", err)
+		}
+	}
+	f, err := opentype.Parse(data)
+	if err == nil {
+		return f, nil
+	}
+	c, cerr := opentype.ParseCollection(data)
+	if cerr != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", path, err)
+	}
+	return c.Font(0)
+}
+
+// plainLines splits the input into lines in the foreground color. Trailing
+// newlines, such as the one added by echo, are dropped.
+func (style *textStyle) plainLines(input string) []textLine {
+	var lines []textLine
+	for _, s := range splitLines(input) {
+		lines = append(lines, textLine{spans: []textSpan{{text: expandTabs(s, style.tabWidth), color: style.fg}}})
+	}
+	return lines
+}
+
+// splitLines splits the input into lines, dropping trailing newlines and
+// carriage returns
+func splitLines(input string) []string {
+	input = strings.TrimRight(input, "\r\n")
+	lines := strings.Split(input, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// expandTabs replaces tabs with spaces up to the next tab stop, counting
+// wide characters as two columns
+func expandTabs(s string, tabWidth int) string {
+	s, _ = expandTabsAt(s, 0, tabWidth)
+	return s
+}
+
+// expandTabsAt is expandTabs for text starting at the given column, which
+// also returns the column after the text
+func expandTabsAt(s string, col, tabWidth int) (string, int) {
+	if !strings.Contains(s, "\t") {
+		return s, col + stringWidth(s)
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\t' {
+			n := tabWidth - col%tabWidth
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		b.WriteRune(r)
+		col += runeWidth(r)
+	}
+	return b.String(), col
+}
+
+// hasGlyph reports whether the font has a glyph for the rune
+func (style *textStyle) hasGlyph(r rune) bool {
+	i, err := style.font.GlyphIndex(&style.buf, r)
+	return err == nil && i != 0
+}
+
+// advance returns the advance of the rune. Runes missing from the font take
+// their width in columns, so that the layout stays on the monospace grid.
+func (style *textStyle) advance(r rune) fixed.Int26_6 {
+	if style.hasGlyph(r) {
+		if adv, ok := style.face.GlyphAdvance(r); ok {
+			return adv
+		}
+	}
+	return style.cell * fixed.Int26_6(runeWidth(r))
+}
+
+// lineWidth returns the width of the line
+func (style *textStyle) lineWidth(line textLine) fixed.Int26_6 {
+	var w fixed.Int26_6
+	for _, span := range line.spans {
+		w += style.textWidth(span.text)
+	}
+	return w
+}
+
+// textWidth returns the width of the text
+func (style *textStyle) textWidth(s string) fixed.Int26_6 {
+	var w fixed.Int26_6
+	for _, r := range s {
+		w += style.advance(r)
+	}
+	return w
+}
+
+// lineHeight returns the distance between baselines
+func (style *textStyle) lineHeight() int {
+	return style.face.Metrics().Height.Ceil()
+}
+
+// size returns the size of the image the lines are drawn on
+func (style *textStyle) size(lines []textLine) (width, height int) {
+	var w fixed.Int26_6
+	for _, line := range lines {
+		w = max(w, style.lineWidth(line))
+	}
+	return max(w.Ceil()+2*style.padding, 1), max(len(lines)*style.lineHeight()+2*style.padding, 1)
+}
+
+// draw draws the lines on an image filled with the background color
+func (style *textStyle) draw(lines []textLine) *image.RGBA {
+	width, height := style.size(lines)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(style.bg), image.Point{}, draw.Src)
+
+	ascent := style.face.Metrics().Ascent
+	for i, line := range lines {
+		if line.highlight {
+			y := style.padding + i*style.lineHeight()
+			draw.Draw(img, image.Rect(0, y, width, y+style.lineHeight()), image.NewUniform(style.highlight), image.Point{}, draw.Src)
+		}
+		dot := fixed.Point26_6{
+			X: fixed.I(style.padding),
+			Y: fixed.I(style.padding+i*style.lineHeight()) + ascent,
+		}
+		for _, span := range line.spans {
+			dot.X = style.drawString(img, dot, span.text, span.color)
+		}
+	}
+	return img
+}
+
+// drawString draws the text with its baseline starting at dot, returning the
+// x of the end of the text
+func (style *textStyle) drawString(img draw.Image, dot fixed.Point26_6, s string, c rgba) fixed.Int26_6 {
+	src := image.NewUniform(c)
+	for _, r := range s {
+		if style.hasGlyph(r) {
+			dr, mask, maskp, _, ok := style.face.Glyph(dot, r)
+			if ok {
+				draw.DrawMask(img, dr, src, image.Point{}, mask, maskp, draw.Over)
+			}
+		}
+		dot.X += style.advance(r)
+	}
+	return dot.X
+}
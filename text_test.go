@@ -0,0 +1,158 @@
+package laminate
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func decodeTestPNG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	return img
+}
+
+func TestRenderText(t *testing.T) {
+	render := func(input string, vars map[string]string) image.Image {
+		t.Helper()
+		data, err := renderText(&builtinRequest{lang: "text", input: input, format: "png", vars: vars})
+		if err != nil {
+			t.Fatalf("renderText() error = %v", err)
+		}
+		return decodeTestPNG(t, data)
+	}
+
+	one := render("hello", nil)
+	two := render("hello\nworld\n\n", nil)
+	if one.Bounds().Dx() != two.Bounds().Dx() {
+		t.Errorf("Expected the same width, got %d and %d", one.Bounds().Dx(), two.Bounds().Dx())
+	}
+	if two.Bounds().Dy() <= one.Bounds().Dy() {
+		t.Errorf("Expected two lines to be taller than one, got %d and %d", two.Bounds().Dy(), one.Bounds().Dy())
+	}
+
+	// Padding and background
+	img := render("x", map[string]string{"padding": "0", "background": "#ff0000"})
+	if r, g, b, _ := img.At(img.Bounds().Dx()-1, img.Bounds().Dy()-1).RGBA(); r>>8 != 0xff || g != 0 || b != 0 {
+		t.Errorf("Expected a red background, got %v", img.At(0, 0))
+	}
+	padded := render("x", map[string]string{"padding": "10"})
+	if padded.Bounds().Dx() != img.Bounds().Dx()+20 {
+		t.Errorf("Expected padding to add 20px, got widths %d and %d", img.Bounds().Dx(), padded.Bounds().Dx())
+	}
+
+	// Larger font
+	large := render("hello", map[string]string{"font_size": "32"})
+	if large.Bounds().Dx() <= one.Bounds().Dx() {
+		t.Errorf("Expected a larger font to be wider, got %d and %d", large.Bounds().Dx(), one.Bounds().Dx())
+	}
+
+	// Deterministic output
+	a, err := renderText(&builtinRequest{input: "same", format: "png"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b, err := renderText(&builtinRequest{input: "same", format: "png"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(a) == 0 {
+		t.Error("Expected non-empty output")
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("Expected identical output for identical input")
+	}
+}
+
+func TestRenderText_Errors(t *testing.T) {
+	tests := []struct {
+		vars   map[string]string
+		errMsg string
+	}{
+		{map[string]string{"font_size": "big"}, "font_size must be a positive number"},
+		{map[string]string{"font_size": "200000"}, "font_size must be a positive number up to 512"},
+		{map[string]string{"padding": "-1"}, "padding must be an integer from 0 to 1024"},
+		{map[string]string{"tab_width": "0"}, "tab_width must be an integer from 1 to 32"},
+		{map[string]string{"foreground": "purple"}, `foreground: invalid color "purple"`},
+		{map[string]string{"font": "testdata/missing.ttf"}, "failed to read font"},
+	}
+	for _, tt := range tests {
+		_, err := renderText(&builtinRequest{input: "x", format: "png", vars: tt.vars})
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("renderText(%v) error = %v, want %q", tt.vars, err, tt.errMsg)
+		}
+	}
+
+	// The size is checked before anything is drawn
+	vars := map[string]string{"font_size": "512"}
+	_, err := renderText(&builtinRequest{input: strings.Repeat("x\n", 10000), format: "png", vars: vars})
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("Expected the image to be too large, got %v", err)
+	}
+}
+
+func TestTextStyle_Width(t *testing.T) {
+	style, err := newTextStyle(&builtinRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer style.face.Close()
+	width := func(s string) int {
+		return style.lineWidth(textLine{spans: []textSpan{{text: s}}}).Round()
+	}
+	// Go Mono has no CJK glyphs, which then keep two columns
+	if got, want := width("日本"), width("abcd"); got != want {
+		t.Errorf("Expected CJK to take two columns, got %d, want %d", got, want)
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	tests := []struct {
+		in       string
+		tabWidth int
+		want     string
+	}{
+		{"a\tb", 4, "a   b"},
+		{"\tb", 2, "  b"},
+		{"abcd\te", 4, "abcd    e"},
+		{"日\tx", 4, "日  x"},
+		{"no tabs", 4, "no tabs"},
+	}
+	for _, tt := range tests {
+		if got := expandTabs(tt.in, tt.tabWidth); got != tt.want {
+			t.Errorf("expandTabs(%q, %d) = %q, want %q", tt.in, tt.tabWidth, got, tt.want)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    rgba
+		wantErr bool
+	}{
+		{in: "#336699", want: hexColor(0x336699ff)},
+		{in: "#369", want: hexColor(0x336699ff)},
+		{in: "#33669980", want: hexColor(0x33669980)},
+		{in: "White", want: hexColor(0xffffffff)},
+		{in: "transparent", want: hexColor(0)},
+		{in: "336699", wantErr: true},
+		{in: "#12345", wantErr: true},
+		{in: "#gggggg", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseColor(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseColor(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseColor(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
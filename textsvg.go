@@ -0,0 +1,81 @@
+package laminate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// render draws the lines in the given format, png or svg
+func (style *textStyle) render(lines []textLine, format string) ([]byte, error) {
+	if err := checkImageSize(style.size(lines)); err != nil {
+		return nil, err
+	}
+	switch format {
+	case "png":
+		return encodePNG(style.draw(lines))
+	case "svg":
+		return style.svg(lines), nil
+	}
+	return nil, fmt.Errorf("unsupported format %s", format)
+}
+
+// svg draws the lines as SVG text, laid out like draw: every span is
+// positioned on its own, so that columns line up whatever font the viewer
+// falls back to
+func (style *textStyle) svg(lines []textLine) []byte {
+	width, height := style.size(lines)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+	if style.bg.A != 0 {
+		fmt.Fprintf(&b, `<rect width="%d" height="%d" %s/>`+"\n", width, height, svgFill(style.bg))
+	}
+	for i, line := range lines {
+		if line.highlight {
+			fmt.Fprintf(&b, `<rect y="%d" width="%d" height="%d" %s/>`+"\n",
+				style.padding+i*style.lineHeight(), width, style.lineHeight(), svgFill(style.highlight))
+		}
+	}
+	fmt.Fprintf(&b, `<text font-family="%s" font-size="%s" xml:space="preserve" style="white-space:pre">`+"\n",
+		svgEscape(style.fontFamily()), formatFixed(fixed.Int26_6(style.fontSize*64)))
+
+	ascent := style.face.Metrics().Ascent
+	for i, line := range lines {
+		y := fixed.I(style.padding+i*style.lineHeight()) + ascent
+		x := fixed.I(style.padding)
+		for _, span := range line.spans {
+			// Surrounding spaces are left out, so that every element starts
+			// with a glyph at its computed position
+			text := strings.TrimLeft(span.text, " ")
+			x += style.advance(' ') * fixed.Int26_6(len(span.text)-len(text))
+			if trimmed := strings.TrimRight(text, " "); trimmed != "" {
+				fmt.Fprintf(&b, `<tspan x="%s" y="%s" %s>%s</tspan>`,
+					formatFixed(x), formatFixed(y), svgFill(span.color), svgEscape(trimmed))
+			}
+			for _, r := range text {
+				x += style.advance(r)
+			}
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("</text>\n</svg>\n")
+	return []byte(b.String())
+}
+
+// fontFamily returns the font-family of the font, falling back to monospace
+func (style *textStyle) fontFamily() string {
+	name, err := style.font.Name(&style.buf, sfnt.NameIDFamily)
+	if err != nil || name == "" {
+		return "monospace"
+	}
+	return name + ", monospace"
+}
+
+// formatFixed formats a 26.6 fixed-point value as a decimal number
+func formatFixed(v fixed.Int26_6) string {
+	return strconv.FormatFloat(float64(v)/64, 'f', -1, 64)
+}
@@ -0,0 +1,82 @@
+package laminate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// assertWellFormedSVG fails unless data is well-formed XML with an svg root
+func assertWellFormedSVG(t *testing.T, data []byte) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("<svg ")) {
+		t.Errorf("Expected an svg element, got %q", data[:min(32, len(data))])
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatalf("Expected well-formed SVG, got %v:\n%s", err, data)
+		}
+	}
+}
+
+func TestRenderText_SVG(t *testing.T) {
+	req := &builtinRequest{input: "a <b> & c\n  indented\n", format: "svg", vars: map[string]string{"background": "#336699"}}
+	data, err := renderText(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertWellFormedSVG(t, data)
+	svg := string(data)
+	for _, want := range []string{
+		`fill="#336699"`,
+		`font-family="Go Mono, monospace"`,
+		`>a &lt;b&gt; &amp; c</tspan>`,
+		`<tspan x="36" y=`, // two spaces of 10px after the 16px padding
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Expected SVG to contain %q, got:\n%s", want, svg)
+		}
+	}
+
+	// Same size as the PNG
+	png, err := renderText(&builtinRequest{input: req.input, format: "png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := decodeTestPNG(t, png).Bounds()
+	if want := fmt.Sprintf(`width="%d" height="%d"`, b.Dx(), b.Dy()); !strings.Contains(svg, want) {
+		t.Errorf("Expected SVG to contain %q, got:\n%s", want, svg)
+	}
+
+	again, err := renderText(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Error("Expected identical output for identical input")
+	}
+}
+
+func TestRenderCode_SVG(t *testing.T) {
+	data, err := renderCode(&builtinRequest{lang: "go", input: "package main\n", format: "svg", vars: map[string]string{"highlight": "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertWellFormedSVG(t, data)
+	svg := string(data)
+	// The github theme colors keywords red and highlights lines
+	for _, want := range []string{`fill="#cf222e">package</tspan>`, `<rect y="16"`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Expected SVG to contain %q, got:\n%s", want, svg)
+		}
+	}
+	if detectFormat(data) != "svg" {
+		t.Error("Expected the output to be detected as SVG")
+	}
+}
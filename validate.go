@@ -0,0 +1,110 @@
+package laminate
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+)
+
+// knownFormats are the formats detectFormat can recognize. Output for any
+// other ext is only checked for emptiness.
+var knownFormats = map[string]bool{
+	"png":  true,
+	"jpg":  true,
+	"gif":  true,
+	"webp": true,
+	"bmp":  true,
+	"svg":  true,
+	"pdf":  true,
+}
+
+// detectFormat returns the format of data sniffed from its content, such as
+// "png" or "svg", "html" for HTML documents, or "" when it is unknown.
+func detectFormat(data []byte) string {
+	switch ct := http.DetectContentType(data); {
+	case ct == "image/png":
+		return "png"
+	case ct == "image/jpeg":
+		return "jpg"
+	case ct == "image/gif":
+		return "gif"
+	case ct == "image/webp":
+		return "webp"
+	case ct == "image/bmp":
+		return "bmp"
+	case ct == "application/pdf":
+		return "pdf"
+	case strings.HasPrefix(ct, "text/"):
+		// SVG opening with a comment is sniffed as HTML, so check it first
+		if isSVG(data) {
+			return "svg"
+		}
+		if strings.HasPrefix(ct, "text/html") {
+			return "html"
+		}
+	}
+	return ""
+}
+
+// isSVG reports whether data looks like an SVG document: an <svg> element,
+// preceded by nothing but an XML declaration, comments and an SVG doctype
+func isSVG(data []byte) bool {
+	rest := bytes.TrimSpace(data[:min(len(data), 4096)])
+	for {
+		var end string
+		switch {
+		case bytes.HasPrefix(rest, []byte("<svg")):
+			return true
+		case bytes.HasPrefix(rest, []byte("<?")):
+			end = "?>"
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			end = "-->"
+		case len(rest) >= 13 && bytes.EqualFold(rest[:13], []byte("<!doctype svg")):
+			end = ">"
+		default:
+			return false
+		}
+		i := bytes.Index(rest, []byte(end))
+		if i < 0 {
+			return false
+		}
+		rest = bytes.TrimSpace(rest[i+len(end):])
+	}
+}
+
+// validateOutput checks the generated output against the expected ext.
+// Empty output and raster images that fail to decode are rejected. A format
+// mismatch is returned as a warning, or as an error when strict is true.
+func validateOutput(data []byte, ext string, strict bool) (warning string, err error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("command produced empty output")
+	}
+	detected, expected := detectFormat(data), normalizeFormat(ext)
+	switch detected {
+	case "png", "jpg", "gif":
+		if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+			return "", fmt.Errorf("command produced an undecodable %s image: %w", detected, err)
+		}
+	case "html":
+		if expected != "html" {
+			return "", fmt.Errorf("command produced an HTML document instead of an image")
+		}
+	}
+
+	if !knownFormats[expected] || detected == expected {
+		return "", nil
+	}
+	msg := fmt.Sprintf("output does not look like %s", expected)
+	if detected != "" {
+		msg = fmt.Sprintf("output looks like %s, not %s", detected, expected)
+	}
+	if strict {
+		return "", fmt.Errorf("%s", msg)
+	}
+	return msg, nil
+}
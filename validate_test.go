@@ -0,0 +1,98 @@
+package laminate
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodeTestImage(t *testing.T, format string) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"png", encodeTestImage(t, "png"), "png"},
+		{"jpg", encodeTestImage(t, "jpg"), "jpg"},
+		{"gif", encodeTestImage(t, "gif"), "gif"},
+		{"pdf", []byte("%PDF-1.7\n"), "pdf"},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "svg"},
+		{"svg_with_xml_declaration", []byte("<?xml version=\"1.0\"?>\n<!DOCTYPE svg>\n<svg></svg>"), "svg"},
+		{"svg_with_comment", []byte("<!-- Generator: Inkscape -->\n<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), "svg"},
+		{"html", []byte("<!DOCTYPE html><html><body>502 Bad Gateway</body></html>"), "html"},
+		{"html_with_svg", []byte("<!DOCTYPE html><html><body><svg></svg></body></html>"), "html"},
+		{"text", []byte("error: something went wrong"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := detectFormat(tt.data); result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	pngData := encodeTestImage(t, "png")
+	tests := []struct {
+		name     string
+		data     []byte
+		ext      string
+		strict   bool
+		warning  bool
+		hasError bool
+	}{
+		{"valid_png", pngData, "png", false, false, false},
+		{"valid_jpeg_alias", encodeTestImage(t, "jpg"), "jpeg", true, false, false},
+		{"valid_svg", []byte("<svg></svg>"), "svg", true, false, false},
+		{"empty", nil, "png", false, false, true},
+		{"truncated_png", pngData[:20], "png", false, false, true},
+		{"html_error_page", []byte("<html><body>error</body></html>"), "png", false, false, true},
+		{"html_as_html", []byte("<html><body>chart</body></html>"), "html", true, false, false},
+		{"jpeg_as_png_warns", encodeTestImage(t, "jpg"), "png", false, true, false},
+		{"jpeg_as_png_strict", encodeTestImage(t, "jpg"), "png", true, false, true},
+		{"text_as_png_warns", []byte("usage: tool [options]"), "png", false, true, false},
+		{"unknown_ext", []byte("anything"), "txt", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning, err := validateOutput(tt.data, tt.ext, tt.strict)
+			if tt.hasError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (warning != "") != tt.warning {
+				t.Errorf("Expected warning=%v, got %q", tt.warning, warning)
+			}
+		})
+	}
+}
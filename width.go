@@ -0,0 +1,44 @@
+package laminate
+
+// wideRanges are the East Asian Wide and Fullwidth ranges that take two
+// columns in monospace layouts
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},   // Hangul Jamo
+	{0x2e80, 0x303e},   // CJK radicals, Kangxi, CJK symbols and punctuation
+	{0x3041, 0x33ff},   // Hiragana, Katakana, Bopomofo, CJK compatibility
+	{0x3400, 0x4dbf},   // CJK Unified Ideographs Extension A
+	{0x4e00, 0x9fff},   // CJK Unified Ideographs
+	{0xa000, 0xa4cf},   // Yi
+	{0xac00, 0xd7a3},   // Hangul syllables
+	{0xf900, 0xfaff},   // CJK compatibility ideographs
+	{0xfe30, 0xfe4f},   // CJK compatibility forms
+	{0xff00, 0xff60},   // Fullwidth forms
+	{0xffe0, 0xffe6},   // Fullwidth signs
+	{0x1f300, 0x1f64f}, // Pictographs and emoticons
+	{0x1f900, 0x1f9ff}, // Supplemental symbols and pictographs
+	{0x20000, 0x3fffd}, // CJK Unified Ideographs Extension B and later
+}
+
+// runeWidth returns the number of columns the rune takes in a monospace
+// layout
+func runeWidth(r rune) int {
+	if r < 0x1100 {
+		return 1
+	}
+	for _, wr := range wideRanges {
+		if r >= wr[0] && r <= wr[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// stringWidth returns the number of columns the string takes in a monospace
+// layout
+func stringWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
@@ -0,0 +1,273 @@
+package laminate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	osexec "os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/k1LoW/exec"
+)
+
+// WorkerConfig configures a long-running process that renders jobs sent to it
+// over a line-delimited JSON protocol on stdin/stdout, instead of starting a
+// command for every render
+type WorkerConfig struct {
+	Command []string `yaml:"command"`
+	MaxJobs int      `yaml:"max_jobs"` // recycle the worker after this many jobs; 0 means never
+}
+
+// workerRequest is a render job sent to a worker as a single JSON line. Type
+// is set for plugins only.
+type workerRequest struct {
+	Type     string              `json:"type,omitempty"`
+	ID       int                 `json:"id,omitempty"`
+	Protocol int                 `json:"protocol,omitempty"`
+	Lang     string              `json:"lang,omitempty"`
+	Input    string              `json:"input,omitempty"`
+	Format   string              `json:"format,omitempty"`
+	Vars     map[string][]string `json:"vars,omitempty"`
+}
+
+// workerResponse is the worker's reply to a job, as a single JSON line. Data
+// is base64 encoded.
+type workerResponse struct {
+	ID          int      `json:"id"`
+	Data        []byte   `json:"data"`
+	ContentType string   `json:"content_type,omitempty"`
+	Diagnostics []string `json:"diagnostics,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// errWorkerCrashed is returned when the worker exits or breaks the protocol
+var errWorkerCrashed = errors.New("worker crashed")
+
+// worker is a running worker or plugin process
+type worker struct {
+	argv   []string
+	cmd    *osexec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *tailBuffer
+	jobs   int
+	nextID int
+}
+
+// workerPool keeps one worker or plugin process per rule alive across renders
+type workerPool struct {
+	mu      sync.Mutex
+	workers map[*Command]*worker
+}
+
+// get returns the rule's running process, starting it if needed. A plugin
+// is started with a handshake.
+func (p *workerPool) get(ctx context.Context, cmd *Command, rlimits *Rlimits, diag *diagnostics) (*worker, error) {
+	if w := p.workers[cmd]; w != nil {
+		return w, nil
+	}
+	if p.workers == nil {
+		p.workers = make(map[*Command]*worker)
+	}
+	w, err := startWorker(cmd, rlimits)
+	if err != nil {
+		return nil, &CommandError{Rule: cmd.name(), Argv: cmd.workerArgv(), ExitStatus: -1, Err: err}
+	}
+	diag.explainf("started worker %q (pid %d)", w.argv, w.cmd.Process.Pid)
+	if cmd.Plugin != "" {
+		res, err := w.handshake(ctx, cmd)
+		if err != nil {
+			w.stop()
+			stderr := w.stderr.String()
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("plugin interrupted: %w", ctx.Err())
+			}
+			return nil, &CommandError{Rule: cmd.name(), Argv: w.argv, ExitStatus: -1, Stderr: stderr, Err: err}
+		}
+		if err := savePluginInfo(cmd.Plugin, res); err != nil {
+			diag.warn("failed to remember the handshake of plugin %s: %v", cmd.Plugin, err)
+		}
+	}
+	p.workers[cmd] = w
+	return w, nil
+}
+
+// handshake starts the rule's plugin, if it is not running yet, so that its
+// declared langs and formats are known
+func (p *workerPool) handshake(ctx context.Context, cmd *Command, rlimits *Rlimits, diag *diagnostics) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.get(ctx, cmd, rlimits, diag)
+	return err
+}
+
+// render sends a job to the rule's worker, starting the worker if needed.
+// When the worker crashes, it is restarted and the job is tried once more.
+func (p *workerPool) render(ctx context.Context, cmd *Command, req *workerRequest, rlimits *Rlimits, diag *diagnostics) (*workerResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		w, err := p.get(ctx, cmd, rlimits, diag)
+		if err != nil {
+			return nil, err
+		}
+		res, err := w.do(ctx, req)
+		if err != nil {
+			// stop waits for the process and its stderr copying to finish
+			w.stop()
+			stderr := w.stderr.String()
+			delete(p.workers, cmd)
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("worker interrupted: %w", ctx.Err())
+			}
+			if attempt == 1 {
+				diag.explainf("worker %q crashed, restarting it", w.argv)
+				continue
+			}
+			return nil, &CommandError{Rule: cmd.name(), Argv: w.argv, ExitStatus: -1, Stderr: stderr, Err: err}
+		}
+
+		w.jobs++
+		if cmd.Worker != nil && cmd.Worker.MaxJobs > 0 && w.jobs >= cmd.Worker.MaxJobs {
+			diag.explainf("recycling worker %q after %d jobs", w.argv, w.jobs)
+			w.stop()
+			delete(p.workers, cmd)
+		}
+		if res.Error != "" {
+			// The job failed, but the worker is fine
+			return nil, &CommandError{Rule: cmd.name(), Argv: w.argv, ExitStatus: -1, Stderr: strings.Join(res.Diagnostics, "\n"), Err: errors.New(res.Error)}
+		}
+		return res, nil
+	}
+}
+
+// close stops all workers
+func (p *workerPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for cmd, w := range p.workers {
+		w.stop()
+		delete(p.workers, cmd)
+	}
+}
+
+// startWorker starts the rule's worker or plugin with the rule's env. Unlike
+// commands, workers outlive a single job, so the env is not expanded as
+// templates.
+func startWorker(rule *Command, rlimits *Rlimits) (*worker, error) {
+	argv := rule.workerArgv()
+	if len(argv) == 0 {
+		return nil, &ConfigError{Err: fmt.Errorf("worker command is empty")}
+	}
+	runArgv := argv
+	if !rlimits.isZero() {
+		prefix, err := rlimitArgv(rlimits)
+		if err != nil {
+			return nil, err
+		}
+		runArgv = append(prefix, argv...)
+	}
+	cmd := exec.Command(runArgv[0], runArgv[1:]...)
+	if len(rule.Env) > 0 {
+		cmd.Env = os.Environ()
+		for _, k := range slices.Sorted(maps.Keys(rule.Env)) {
+			cmd.Env = append(cmd.Env, k+"="+rule.Env[k])
+		}
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	w := &worker{
+		argv:   argv,
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		stderr: newTailBuffer(stderrTailSize),
+	}
+	cmd.Stderr = w.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// do sends a job to the worker and waits for its response. Any error means
+// that the worker crashed, broke the protocol or was interrupted, while a
+// failed job is reported in the response.
+func (w *worker) do(ctx context.Context, req *workerRequest) (*workerResponse, error) {
+	w.nextID++
+	req.ID = w.nextID
+	var res workerResponse
+	if err := w.exchange(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	if res.ID != req.ID {
+		return nil, fmt.Errorf("%w: response id %d does not match request id %d", errWorkerCrashed, res.ID, req.ID)
+	}
+	return &res, nil
+}
+
+// exchange writes req as a JSON line to the worker and reads a JSON line from
+// it into res
+func (w *worker) exchange(ctx context.Context, req, res any) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		if _, err := w.stdin.Write(append(b, '\n')); err != nil {
+			done <- fmt.Errorf("%w: %v", errWorkerCrashed, err)
+			return
+		}
+		line, err := w.stdout.ReadBytes('\n')
+		if err != nil {
+			done <- fmt.Errorf("%w: %v", errWorkerCrashed, err)
+			return
+		}
+		if err := json.Unmarshal(line, res); err != nil {
+			done <- fmt.Errorf("%w: invalid response: %v", errWorkerCrashed, err)
+			return
+		}
+		done <- nil
+	}()
+	select {
+	case <-ctx.Done():
+		// The worker is stopped by the caller, which unblocks the goroutine
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// stop asks the worker to exit by closing its stdin, and kills its process
+// group when it does not exit within the grace period
+func (w *worker) stop() {
+	w.stdin.Close()
+	exited := make(chan struct{})
+	go func() {
+		w.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(killGracePeriod):
+		exec.KillCommand(w.cmd)
+		<-exited
+	}
+}